@@ -0,0 +1,482 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/idletekz/go-graphql/discovery"
+	"github.com/idletekz/go-graphql/gql"
+	"github.com/machinebox/graphql"
+)
+
+// AuthConfig configures the credentials used with GitHub: an app when App
+// is set, or else personal access tokens read from Tokens, by default from
+// the GITHUB_TOKEN environment variable. An app discovers the repositories
+// of its installation.
+type AuthConfig struct {
+	// Tokens are used in turn, request after request, to spread the rate
+	// limit cost over their accounts. Discovery and issues, which depend on
+	// the viewer, always use the first one, and so do the requests for
+	// private and internal repositories, which the other accounts may not
+	// see.
+	Tokens []TokenConfig `yaml:"tokens"`
+	App    *AppConfig    `yaml:"app"`
+}
+
+// TokenConfig reads a personal access token from one of: the environment
+// variable Env, the file File, the password of the machine Netrc in the
+// netrc file ($NETRC or ~/.netrc), or the output of Command.
+type TokenConfig struct {
+	Env     string   `yaml:"env"`
+	File    string   `yaml:"file"`
+	Netrc   string   `yaml:"netrc"`
+	Command []string `yaml:"command"`
+}
+
+// AppConfig configures GitHub App authentication: a JWT signed with the
+// private key of the app is exchanged for an installation token. The key is
+// read from PrivateKeyFile, or from the environment variable named by
+// PrivateKeyEnv.
+type AppConfig struct {
+	ID int64 `yaml:"id"`
+	// InstallationID may be left out when the app has a single
+	// installation.
+	InstallationID int64  `yaml:"installationId"`
+	PrivateKeyFile string `yaml:"privateKeyFile"`
+	PrivateKeyEnv  string `yaml:"privateKeyEnv"`
+	// APIURL is the REST API serving the token endpoint, restURL by
+	// default.
+	APIURL string `yaml:"apiUrl"`
+}
+
+// tokenSource provides the token authenticating requests to GitHub.
+type tokenSource interface {
+	token(ctx context.Context) (string, error)
+	// validate checks, through client, that the credentials are accepted.
+	validate(ctx context.Context, client *graphql.Client) error
+	// login returns the login of the account authoring issues.
+	login(ctx context.Context, client *graphql.Client) (string, error)
+}
+
+// tokens authenticates GraphQL and REST requests, through
+// apiTransport, and clones. It is set by main.
+var tokens tokenSource
+
+// newTokenSource returns the token source configured by c.
+func newTokenSource(ctx context.Context, c *AuthConfig) (tokenSource, error) {
+	if c.App != nil {
+		key, err := c.App.privateKey()
+		if err != nil {
+			return nil, fmt.Errorf("newTokenSource: %s", err)
+		}
+		return &appTokenSource{
+			config: c.App,
+			key:    key,
+			client: &http.Client{Transport: httpTransport, Timeout: 30 * time.Second},
+		}, nil
+	}
+	configs := c.Tokens
+	if len(configs) == 0 {
+		configs = []TokenConfig{{Env: "GITHUB_TOKEN"}}
+	}
+	s := &staticTokens{}
+	for _, tc := range configs {
+		t, err := tc.read(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("newTokenSource: %s: %s", tc, err)
+		}
+		if t == "" {
+			return nil, fmt.Errorf("newTokenSource: %s: empty token", tc)
+		}
+		addSecret(t)
+		s.names = append(s.names, tc.String())
+		s.values = append(s.values, t)
+	}
+	return s, nil
+}
+
+// credentialEnv names the environment variables holding credentials, of
+// the token sources and the notifiers, hidden from the commands of run
+// mode. It is set by main.
+var credentialEnv []string
+
+// envNames returns the environment variables that may hold the credentials
+// of c, or lead to them.
+func (c *AuthConfig) envNames() []string {
+	names := []string{"GITHUB_TOKEN", "GH_TOKEN", "NETRC"}
+	for _, tc := range c.Tokens {
+		if tc.Env != "" {
+			names = append(names, tc.Env)
+		}
+	}
+	if c.App != nil && c.App.PrivateKeyEnv != "" {
+		names = append(names, c.App.PrivateKeyEnv)
+	}
+	return names
+}
+
+// tokenIndexKey is the context key of the index of the static token to use.
+type tokenIndexKey struct{}
+
+// withPrimaryToken makes the requests made with ctx use the first static
+// token, for those depending on the viewer and for writes: the other
+// tokens are only known to read public repositories.
+func withPrimaryToken(ctx context.Context) context.Context {
+	return context.WithValue(ctx, tokenIndexKey{}, 0)
+}
+
+// forRepos makes the requests made with ctx on behalf of repos use the
+// first static token, which discovered them, unless they are all public.
+// It is meant for reads; writes always use the primary token.
+func forRepos(ctx context.Context, repos ...*discovery.Repo) context.Context {
+	for _, r := range repos {
+		if r.Private {
+			return withPrimaryToken(ctx)
+		}
+	}
+	return ctx
+}
+
+// staticTokens are tokens that never expire, such as personal access
+// tokens, used in turn.
+type staticTokens struct {
+	names  []string // sources, for error messages
+	values []string
+	next   uint32
+}
+
+func (s *staticTokens) token(ctx context.Context) (string, error) {
+	i, ok := ctx.Value(tokenIndexKey{}).(int)
+	if !ok {
+		i = int(atomic.AddUint32(&s.next, 1)-1) % len(s.values)
+	}
+	return s.values[i], nil
+}
+
+func (s *staticTokens) validate(ctx context.Context, client *graphql.Client) error {
+	for i, name := range s.names {
+		var respData gql.ViewerResponse
+		ctx := context.WithValue(ctx, tokenIndexKey{}, i)
+		err := client.Run(ctx, graphql.NewRequest(gql.ViewerQuery), &respData)
+		if err == nil && respData.Viewer.Login == "" {
+			// The GraphQL client ignores the status code of responses
+			// without errors, such as 401 Bad credentials.
+			err = fmt.Errorf("no viewer returned")
+		}
+		if err != nil {
+			return fmt.Errorf("token from %s is not accepted by GitHub, check that it is valid and not expired: %s", name, err)
+		}
+		slog.Info("authenticated", "login", respData.Viewer.Login, "token", name)
+	}
+	return nil
+}
+
+func (s *staticTokens) login(ctx context.Context, client *graphql.Client) (string, error) {
+	var respData gql.ViewerResponse
+	if err := client.Run(ctx, graphql.NewRequest(gql.ViewerQuery), &respData); err != nil {
+		return "", err
+	}
+	return respData.Viewer.Login, nil
+}
+
+// read returns the token.
+func (c TokenConfig) read(ctx context.Context) (string, error) {
+	switch {
+	case c.Env != "":
+		return os.Getenv(c.Env), nil
+	case c.File != "":
+		data, err := ioutil.ReadFile(c.File)
+		return strings.TrimSpace(string(data)), err
+	case c.Netrc != "":
+		return netrcPassword(c.Netrc)
+	case len(c.Command) > 0:
+		cmd := exec.CommandContext(ctx, c.Command[0], c.Command[1:]...)
+		cmd.Stderr = os.Stderr
+		out, err := cmd.Output()
+		return strings.TrimSpace(string(out)), err
+	}
+	return "", fmt.Errorf("no env, file, netrc or command")
+}
+
+func (c TokenConfig) String() string {
+	switch {
+	case c.Env != "":
+		return "env " + c.Env
+	case c.File != "":
+		return "file " + c.File
+	case c.Netrc != "":
+		return "netrc machine " + c.Netrc
+	case len(c.Command) > 0:
+		return "command " + strings.Join(c.Command, " ")
+	}
+	return "empty token source"
+}
+
+// netrcPassword returns the password of machine in the netrc file named by
+// $NETRC, by default ~/.netrc. A default entry applies to any machine.
+func netrcPassword(machine string) (string, error) {
+	path := os.Getenv("NETRC")
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		path = filepath.Join(home, ".netrc")
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	var current, password, fallback string
+	fields := strings.Fields(string(data))
+	for i := 0; i < len(fields); i++ {
+		switch fields[i] {
+		case "machine":
+			if i+1 < len(fields) {
+				i++
+				current = fields[i]
+			}
+		case "default":
+			current = "default"
+		case "password":
+			if i+1 < len(fields) {
+				i++
+				if current == machine && password == "" {
+					password = fields[i]
+				} else if current == "default" && fallback == "" {
+					fallback = fields[i]
+				}
+			}
+		}
+	}
+	if password == "" {
+		password = fallback
+	}
+	if password == "" {
+		return "", fmt.Errorf("%s: no password for machine %s", path, machine)
+	}
+	return password, nil
+}
+
+// appTokenRefresh is how long before its expiry an installation token is
+// replaced.
+const appTokenRefresh = 5 * time.Minute
+
+// appTokenSource provides installation tokens of a GitHub App, requesting a
+// new one when the current one is about to expire. Installation tokens are
+// valid for an hour.
+type appTokenSource struct {
+	config *AppConfig
+	key    *rsa.PrivateKey
+	client *http.Client
+
+	mu             sync.Mutex
+	installationID int64
+	current        string
+	expires        time.Time
+}
+
+func (s *appTokenSource) token(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.current != "" && time.Until(s.expires) > appTokenRefresh {
+		return s.current, nil
+	}
+	jwt, err := s.jwt(time.Now())
+	if err != nil {
+		return "", fmt.Errorf("appTokenSource: %s", err)
+	}
+	addSecret(jwt)
+	if s.installationID == 0 {
+		s.installationID = s.config.InstallationID
+	}
+	if s.installationID == 0 {
+		if s.installationID, err = s.installation(ctx, jwt); err != nil {
+			return "", fmt.Errorf("appTokenSource: %s", err)
+		}
+	}
+	id := s.installationID
+	var res struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	if err := s.call(ctx, "POST", fmt.Sprintf("/app/installations/%d/access_tokens", id), jwt, &res); err != nil {
+		return "", fmt.Errorf("appTokenSource: %s", err)
+	}
+	addSecret(res.Token)
+	s.current, s.expires = res.Token, res.ExpiresAt
+	slog.Debug("installation token refreshed", "app", s.config.ID, "installation", id, "expires", s.expires)
+	return s.current, nil
+}
+
+// validate requests an installation token: viewer queries are not
+// available to apps.
+func (s *appTokenSource) validate(ctx context.Context, client *graphql.Client) error {
+	if _, err := s.token(ctx); err != nil {
+		return fmt.Errorf("app %d is not accepted by GitHub, check its ID, installation and private key: %s", s.config.ID, err)
+	}
+	return nil
+}
+
+// login returns the login of the bot account of the app.
+func (s *appTokenSource) login(ctx context.Context, client *graphql.Client) (string, error) {
+	jwt, err := s.jwt(time.Now())
+	if err != nil {
+		return "", fmt.Errorf("appTokenSource: %s", err)
+	}
+	addSecret(jwt)
+	var app struct {
+		Slug string `json:"slug"`
+	}
+	if err := s.call(ctx, "GET", "/app", jwt, &app); err != nil {
+		return "", fmt.Errorf("appTokenSource: %s", err)
+	}
+	return app.Slug + "[bot]", nil
+}
+
+// installation returns the ID of the only installation of the app.
+func (s *appTokenSource) installation(ctx context.Context, jwt string) (int64, error) {
+	var installations []struct {
+		ID int64 `json:"id"`
+	}
+	if err := s.call(ctx, "GET", "/app/installations", jwt, &installations); err != nil {
+		return 0, err
+	}
+	if len(installations) != 1 {
+		return 0, fmt.Errorf("app %d has %d installations, set installationId", s.config.ID, len(installations))
+	}
+	return installations[0].ID, nil
+}
+
+// call makes a request authenticated as the app and decodes its JSON
+// response into v.
+func (s *appTokenSource) call(ctx context.Context, method, path, jwt string, v interface{}) error {
+	base := s.config.APIURL
+	if base == "" {
+		base = restURL
+	}
+	req, err := http.NewRequestWithContext(ctx, method, base+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+jwt)
+	req.Header.Set("Accept", "application/vnd.github+json")
+	res, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("%s %s status code: %v", method, path, res.StatusCode)
+	}
+	return json.NewDecoder(res.Body).Decode(v)
+}
+
+// jwt returns a JSON Web Token identifying the app, signed with RS256. It
+// is backdated by a minute against clock drift and valid for ten, the
+// maximum GitHub accepts.
+func (s *appTokenSource) jwt(now time.Time) (string, error) {
+	enc := base64.RawURLEncoding
+	header := enc.EncodeToString([]byte(`{"alg":"RS256","typ":"JWT"}`))
+	claims, err := json.Marshal(map[string]interface{}{
+		"iat": now.Add(-time.Minute).Unix(),
+		"exp": now.Add(9 * time.Minute).Unix(),
+		"iss": s.config.ID,
+	})
+	if err != nil {
+		return "", err
+	}
+	unsigned := header + "." + enc.EncodeToString(claims)
+	sum := sha256.Sum256([]byte(unsigned))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, sum[:])
+	if err != nil {
+		return "", err
+	}
+	return unsigned + "." + enc.EncodeToString(sig), nil
+}
+
+// privateKey reads the PEM encoded RSA private key of the app, in the
+// PKCS #1 form GitHub generates or in PKCS #8.
+func (c *AppConfig) privateKey() (*rsa.PrivateKey, error) {
+	var data []byte
+	switch {
+	case c.PrivateKeyFile != "":
+		var err error
+		if data, err = ioutil.ReadFile(c.PrivateKeyFile); err != nil {
+			return nil, err
+		}
+	case c.PrivateKeyEnv != "":
+		data = []byte(os.Getenv(c.PrivateKeyEnv))
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("app %d: no PEM private key", c.ID)
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("app %d: %s", c.ID, err)
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("app %d: private key is not RSA", c.ID)
+	}
+	return rsaKey, nil
+}
+
+// authTransport adds the current token to the requests made to the GitHub
+// API hosts, and to no other: webhooks or the tarball
+// download host redirected to must not receive it.
+type authTransport struct {
+	next http.RoundTripper
+}
+
+func (t authTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("Authorization") != "" || !apiHost(req.URL.Host) {
+		return t.next.RoundTrip(req)
+	}
+	if tokens == nil {
+		return nil, fmt.Errorf("authTransport: no token source")
+	}
+	tok, err := tokens.token(req.Context())
+	if err != nil {
+		return nil, err
+	}
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+tok)
+	return t.next.RoundTrip(req)
+}
+
+// apiHost reports whether host serves the GraphQL or REST API.
+func apiHost(host string) bool {
+	for _, u := range []string{graphqlURL, restURL} {
+		if parsed, err := url.Parse(u); err == nil && parsed.Host == host {
+			return true
+		}
+	}
+	return false
+}
+
+// apiTransport is the transport of the clients authenticated by tokens.
+var apiTransport http.RoundTripper = authTransport{next: httpTransport}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/idletekz/go-graphql/discovery"
+)
+
+// fakeApp serves the GitHub App endpoints of appTokenSource for the app 7
+// with the installation 42, checking the JWT of every request.
+type fakeApp struct {
+	t       *testing.T
+	key     *rsa.PrivateKey
+	issued  atomic.Int32
+	expires func(n int32) time.Time // expiry of the nth token
+}
+
+func (f *fakeApp) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := f.checkJWT(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")); err != nil {
+		f.t.Errorf("%s %s: %s", r.Method, r.URL.Path, err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	switch {
+	case r.Method == "GET" && r.URL.Path == "/app":
+		fmt.Fprint(w, `{"slug":"props"}`)
+	case r.Method == "GET" && r.URL.Path == "/app/installations":
+		fmt.Fprint(w, `[{"id":42}]`)
+	case r.Method == "POST" && r.URL.Path == "/app/installations/42/access_tokens":
+		n := f.issued.Add(1)
+		json.NewEncoder(w).Encode(map[string]any{"token": fmt.Sprintf("tok-%d", n), "expires_at": f.expires(n)})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (f *fakeApp) checkJWT(jwt string) error {
+	parts := strings.Split(jwt, ".")
+	if len(parts) != 3 {
+		return fmt.Errorf("malformed JWT %q", jwt)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(&f.key.PublicKey, crypto.SHA256, sum[:], sig); err != nil {
+		return err
+	}
+	data, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return err
+	}
+	var claims struct {
+		Iat, Exp, Iss int64
+	}
+	if err := json.Unmarshal(data, &claims); err != nil {
+		return err
+	}
+	now := time.Now().Unix()
+	if claims.Iss != 7 || claims.Iat > now || claims.Exp <= now || claims.Exp-claims.Iat > 600 {
+		return fmt.Errorf("bad claims %+v", claims)
+	}
+	return nil
+}
+
+func newFakeApp(t *testing.T, expires func(n int32) time.Time) (*appTokenSource, *fakeApp) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeApp{t: t, key: key, expires: expires}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	s := &appTokenSource{config: &AppConfig{ID: 7, APIURL: srv.URL}, key: key, client: srv.Client()}
+	return s, f
+}
+
+func TestAppTokenSource(t *testing.T) {
+	s, f := newFakeApp(t, func(n int32) time.Time {
+		if n == 1 {
+			return time.Now().Add(appTokenRefresh / 2) // about to expire
+		}
+		return time.Now().Add(time.Hour)
+	})
+	ctx := context.Background()
+	for _, want := range []string{"tok-1", "tok-2", "tok-2"} {
+		got, err := s.token(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("token = %q, want %q", got, want)
+		}
+	}
+	if s.installationID != 42 {
+		t.Errorf("installation = %d, want 42", s.installationID)
+	}
+	if n := f.issued.Load(); n != 2 {
+		t.Errorf("%d tokens issued, want 2", n)
+	}
+	login, err := s.login(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if login != "props[bot]" {
+		t.Errorf("login = %q, want props[bot]", login)
+	}
+}
+
+func TestAppTokenSourceRejected(t *testing.T) {
+	s, _ := newFakeApp(t, func(int32) time.Time { return time.Now().Add(time.Hour) })
+	s.config.InstallationID = 43
+	if err := s.validate(context.Background(), nil); err == nil {
+		t.Errorf("validate accepted an unknown installation")
+	}
+}
+
+func TestStaticTokensForRepos(t *testing.T) {
+	s := &staticTokens{names: []string{"a", "b"}, values: []string{"a", "b"}}
+	public := &discovery.Repo{Name: "public"}
+	private := &discovery.Repo{Name: "private", Private: true}
+	tests := []struct {
+		repos []*discovery.Repo
+		want  string
+	}{
+		{[]*discovery.Repo{public}, "ab"},
+		{[]*discovery.Repo{private}, "aa"},
+		{[]*discovery.Repo{public, private}, "aa"},
+	}
+	for _, tt := range tests {
+		ctx := forRepos(context.Background(), tt.repos...)
+		var got string
+		for i := 0; i < 2; i++ {
+			tok, err := s.token(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got += tok
+		}
+		s.next = 0
+		if got != tt.want {
+			t.Errorf("tokens for %d repos = %s, want %s", len(tt.repos), got, tt.want)
+		}
+	}
+}
+
+func TestNetrcPassword(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "netrc")
+	data := `machine example.com login a password wrong
+machine github.com
+  login me
+  password right
+machine api.github.com login me password api
+default login anyone password fallback
+`
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("NETRC", path)
+	tests := []struct {
+		machine, want string
+	}{
+		{"github.com", "right"},
+		{"api.github.com", "api"},
+		{"gitlab.com", "fallback"},
+	}
+	for _, tt := range tests {
+		got, err := netrcPassword(tt.machine)
+		if err != nil {
+			t.Errorf("netrcPassword(%q): %s", tt.machine, err)
+		} else if got != tt.want {
+			t.Errorf("netrcPassword(%q) = %q, want %q", tt.machine, got, tt.want)
+		}
+	}
+	if err := os.WriteFile(path, []byte("machine example.com password x\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := netrcPassword("github.com"); err == nil {
+		t.Errorf("netrcPassword found a password without entry")
+	}
+}
+
+func TestTokenConfigRead(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "token")
+	if err := os.WriteFile(file, []byte("from-file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TEST_TOKEN", "from-env")
+	tests := []struct {
+		config TokenConfig
+		want   string
+	}{
+		{TokenConfig{Env: "TEST_TOKEN"}, "from-env"},
+		{TokenConfig{File: file}, "from-file"},
+		{TokenConfig{Command: []string{"echo", " from-command "}}, "from-command"},
+	}
+	for _, tt := range tests {
+		got, err := tt.config.read(context.Background())
+		if err != nil {
+			t.Errorf("%s: %s", tt.config, err)
+		} else if got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.config, got, tt.want)
+		}
+	}
+	if _, err := (TokenConfig{Command: []string{"false"}}).read(context.Background()); err == nil {
+		t.Errorf("failing command accepted")
+	}
+	if _, err := (TokenConfig{}).read(context.Background()); err == nil {
+		t.Errorf("empty token config accepted")
+	}
+}
@@ -0,0 +1,318 @@
+package clone
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/idletekz/go-graphql/discovery"
+)
+
+// waitDelay bounds the wait for the output of a killed git.
+const waitDelay = 5 * time.Second
+
+// execGit runs the git binary found on PATH.
+type execGit struct{}
+
+func (execGit) clone(ctx context.Context, cl *Cloner, r *discovery.Repo, dir string) error {
+	c := &cl.Config
+	args := []string{
+		"clone",
+		"--depth=1",
+		"-b",
+		r.Branch,
+	}
+	if c.Filter != "" {
+		args = append(args, "--filter="+c.Filter)
+	}
+	if len(c.Sparse) > 0 {
+		args = append(args, "--sparse")
+	}
+	args = append(args, r.URL, r.Name)
+	if err := git(ctx, cl, r, dir, args...); err != nil {
+		return err
+	}
+	if len(c.Sparse) > 0 {
+		args := append([]string{"sparse-checkout", "set", "--cone"}, c.Sparse...)
+		if err := git(ctx, cl, r, filepath.Join(dir, r.Name), args...); err != nil {
+			return fmt.Errorf("sparse-checkout: %s", err)
+		}
+	}
+	return nil
+}
+
+// update fetches the tip of the ref of r into the clone in path and resets
+// its working tree to it, as a new clone would check it out. The origin URL
+// is set again, dropping credentials stored there by older versions.
+func (execGit) update(ctx context.Context, cl *Cloner, r *discovery.Repo, path string) error {
+	c := &cl.Config
+	ref := "refs/heads/" + r.Branch
+	if r.Kind != discovery.KindBranch {
+		ref = "refs/tags/" + r.Branch
+	}
+	fetch := []string{"fetch", "--depth=1"}
+	if c.Filter != "" {
+		fetch = append(fetch, "--filter="+c.Filter)
+	}
+	steps := [][]string{
+		{"remote", "set-url", "origin", r.URL},
+		append(fetch, "origin", ref),
+		{"reset", "--hard", "FETCH_HEAD"},
+		{"clean", "-ffdx"},
+	}
+	if len(c.Sparse) > 0 {
+		steps = append(steps, append([]string{"sparse-checkout", "set", "--cone"}, c.Sparse...))
+	}
+	for _, args := range steps {
+		if err := git(ctx, cl, r, path, args...); err != nil {
+			return fmt.Errorf("update %s: %s", args[0], err)
+		}
+	}
+	return nil
+}
+
+// git runs git with args in dir, logging its output with the fields of r.
+// The Network of cl applies, the token of cl authenticates requests to the
+// host of r, and git is killed when ctx is done.
+func git(ctx context.Context, cl *Cloner, r *discovery.Repo, dir string, args ...string) error {
+	tok, err := cl.token(ctx)
+	if err != nil {
+		return err
+	}
+	out := &logWriter{log: cl.logger(r).With("cmd", "git")}
+	defer out.Flush()
+	cmd := exec.CommandContext(ctx, "git", append(cl.Network.gitArgs(), args...)...)
+	killProcessGroup(cmd)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), gitAuthEnv(r.URL, tok)...)
+	cmd.Stdout = out
+	cmd.Stderr = out
+	return cmd.Run()
+}
+
+// goGit clones in process with go-git, for hosts without a git binary.
+// Partial clone filters are not supported and are ignored; sparse
+// directories are checked out without the files at the root.
+type goGit struct{}
+
+func (goGit) clone(ctx context.Context, cl *Cloner, r *discovery.Repo, dir string) error {
+	c := &cl.Config
+	if c.Filter != "" {
+		cl.logger(r).Warn("go git backend: ignoring clone filter", "filter", c.Filter)
+	}
+	ref := goGitRef(r)
+	tok, err := cl.token(ctx)
+	if err != nil {
+		return err
+	}
+	proxy, ca, cert, key, err := cl.Network.goGitOptions()
+	if err != nil {
+		return err
+	}
+	progress := &logWriter{log: cl.logger(r).With("cmd", "go-git")}
+	defer progress.Flush()
+	path := filepath.Join(dir, r.Name)
+	repo, err := gogit.PlainCloneContext(ctx, path, false, &gogit.CloneOptions{
+		URL:           r.URL,
+		Auth:          &githttp.BasicAuth{Username: "x-access-token", Password: tok},
+		ReferenceName: ref,
+		SingleBranch:  true,
+		Depth:         1,
+		NoCheckout:    len(c.Sparse) > 0,
+		Progress:      progress,
+		ProxyOptions:  proxy,
+		CABundle:      ca,
+		ClientCert:    cert,
+		ClientKey:     key,
+	})
+	if err != nil {
+		return err
+	}
+	if len(c.Sparse) == 0 {
+		return nil
+	}
+	w, err := repo.Worktree()
+	if err != nil {
+		return err
+	}
+	err = w.Checkout(&gogit.CheckoutOptions{
+		Branch:                    ref,
+		SparseCheckoutDirectories: c.Sparse,
+	})
+	if err != nil {
+		return fmt.Errorf("sparse checkout: %s", err)
+	}
+	return nil
+}
+
+// update fetches the tip of the ref of r into the clone in path and resets
+// its working tree to it, removing untracked files.
+func (goGit) update(ctx context.Context, cl *Cloner, r *discovery.Repo, path string) error {
+	c := &cl.Config
+	ref := goGitRef(r)
+	remote := ref
+	if ref.IsBranch() {
+		remote = plumbing.NewRemoteReferenceName("origin", r.Branch)
+	}
+	tok, err := cl.token(ctx)
+	if err != nil {
+		return err
+	}
+	proxy, ca, cert, key, err := cl.Network.goGitOptions()
+	if err != nil {
+		return err
+	}
+	repo, err := gogit.PlainOpen(path)
+	if err != nil {
+		return err
+	}
+	progress := &logWriter{log: cl.logger(r).With("cmd", "go-git")}
+	defer progress.Flush()
+	err = repo.FetchContext(ctx, &gogit.FetchOptions{
+		RemoteURL:    r.URL,
+		RefSpecs:     []config.RefSpec{config.RefSpec("+" + ref + ":" + remote)},
+		Depth:        1,
+		Auth:         &githttp.BasicAuth{Username: "x-access-token", Password: tok},
+		Progress:     progress,
+		Force:        true,
+		ProxyOptions: proxy,
+		CABundle:     ca,
+		ClientCert:   cert,
+		ClientKey:    key,
+	})
+	if err != nil && err != gogit.NoErrAlreadyUpToDate {
+		return fmt.Errorf("fetch: %s", err)
+	}
+	tip, err := repo.Reference(remote, true)
+	if err != nil {
+		return err
+	}
+	w, err := repo.Worktree()
+	if err != nil {
+		return err
+	}
+	if len(c.Sparse) > 0 {
+		err = w.Checkout(&gogit.CheckoutOptions{
+			Hash:                      tip.Hash(),
+			Force:                     true,
+			SparseCheckoutDirectories: c.Sparse,
+		})
+	} else {
+		err = w.Reset(&gogit.ResetOptions{Commit: tip.Hash(), Mode: gogit.HardReset})
+	}
+	if err != nil {
+		return fmt.Errorf("reset: %s", err)
+	}
+	return w.Clean(&gogit.CleanOptions{Dir: true})
+}
+
+// goGitRef returns the reference of the ref of r.
+func goGitRef(r *discovery.Repo) plumbing.ReferenceName {
+	if r.Kind != discovery.KindBranch {
+		return plumbing.NewTagReferenceName(r.Branch)
+	}
+	return plumbing.NewBranchReferenceName(r.Branch)
+}
+
+// logWriter logs every complete line written to it. Lines overwritten with
+// a carriage return, as in git progress output, are dropped.
+type logWriter struct {
+	log  *slog.Logger
+	line []byte
+}
+
+func (w *logWriter) Write(p []byte) (int, error) {
+	for _, c := range p {
+		switch c {
+		case '\n':
+			w.Flush()
+		case '\r':
+			w.line = w.line[:0]
+		default:
+			w.line = append(w.line, c)
+		}
+	}
+	return len(p), nil
+}
+
+// Flush logs the pending line, if any.
+func (w *logWriter) Flush() {
+	if line := bytes.TrimSpace(w.line); len(line) > 0 {
+		w.log.Info(string(line))
+	}
+	w.line = w.line[:0]
+}
+
+// gitAuthEnv returns the environment making git send tok to the host of
+// url. Unlike credentials in the clone URL or in arguments, configuration
+// from the environment is neither visible to other users nor stored in the
+// clone.
+func gitAuthEnv(url, tok string) []string {
+	env := []string{"GIT_TERMINAL_PROMPT=0"}
+	if tok == "" {
+		return env
+	}
+	origin := url
+	if i := strings.Index(url, "//"); i >= 0 {
+		if j := strings.Index(url[i+2:], "/"); j >= 0 {
+			origin = url[:i+2+j]
+		}
+	}
+	basic := base64.StdEncoding.EncodeToString([]byte("x-access-token:" + tok))
+	return append(env,
+		"GIT_CONFIG_COUNT=1",
+		"GIT_CONFIG_KEY_0=http."+origin+"/.extraHeader",
+		"GIT_CONFIG_VALUE_0=Authorization: Basic "+basic,
+	)
+}
+
+// gitArgs returns the options making the git binary use c.
+func (c *Network) gitArgs() []string {
+	var args []string
+	if c.Proxy != "" {
+		args = append(args, "-c", "http.proxy="+c.Proxy)
+	}
+	if c.CAFile != "" {
+		args = append(args, "-c", "http.sslCAInfo="+c.CAFile)
+	}
+	if c.CertFile != "" {
+		args = append(args, "-c", "http.sslCert="+c.CertFile)
+	}
+	if c.KeyFile != "" {
+		args = append(args, "-c", "http.sslKey="+c.KeyFile)
+	}
+	return args
+}
+
+// goGitOptions returns the proxy, CA bundle and client certificate of c,
+// for go-git.
+func (c *Network) goGitOptions() (proxy transport.ProxyOptions, ca, cert, key []byte, err error) {
+	proxy.URL = c.Proxy
+	if c.CAFile != "" {
+		if ca, err = ioutil.ReadFile(c.CAFile); err != nil {
+			return
+		}
+	}
+	if c.CertFile != "" {
+		if cert, err = ioutil.ReadFile(c.CertFile); err != nil {
+			return
+		}
+	}
+	if c.KeyFile != "" {
+		key, err = ioutil.ReadFile(c.KeyFile)
+	}
+	return
+}
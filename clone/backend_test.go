@@ -0,0 +1,43 @@
+package clone
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestGitAuthEnv(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("no git binary")
+	}
+	var got string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get("Authorization")
+		http.NotFound(w, r)
+	}))
+	defer srv.Close()
+	url := srv.URL + "/o/r"
+	cmd := exec.Command("git", "ls-remote", url)
+	cmd.Env = append(os.Environ(), gitAuthEnv(url, "secret")...)
+	out, _ := cmd.CombinedOutput()
+	if want := "Basic " + base64.StdEncoding.EncodeToString([]byte("x-access-token:secret")); got != want {
+		t.Errorf("Authorization = %q, want %q", got, want)
+	}
+	if strings.Contains(string(out), "secret") {
+		t.Errorf("git output holds the token: %s", out)
+	}
+}
+
+func TestGitAuthEnvOtherHost(t *testing.T) {
+	env := strings.Join(gitAuthEnv("https://github.com/o/r", "secret"), "\n")
+	if !strings.Contains(env, "GIT_CONFIG_KEY_0=http.https://github.com/.extraHeader") {
+		t.Errorf("header not scoped to the host of the repository:\n%s", env)
+	}
+	if env := gitAuthEnv("https://github.com/o/r", ""); len(env) != 1 {
+		t.Errorf("header set without token: %q", env)
+	}
+}
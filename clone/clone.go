@@ -0,0 +1,192 @@
+// Package clone makes working trees of the refs found by discovery, with
+// the git binary, go-git or tarball downloads, and manages the clone root:
+// the manifest of its clones, their pruning and its size limits.
+package clone
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/idletekz/go-graphql/discovery"
+)
+
+// Config configures how repositories are cloned.
+type Config struct {
+	// Dir is the clone root, the current directory by default. Clones are
+	// made in Dir/owner/heads/branch/name, or Dir/owner/tags/tag/name for
+	// tags and releases.
+	Dir string `yaml:"dir"`
+	// Backend is exec to run the git binary (the default), go to clone in
+	// process or tarball to download the ref without history.
+	Backend string `yaml:"backend"`
+	// Filter is passed to git clone --filter for a partial clone, e.g.
+	// blob:none to fetch file contents only when they are checked out.
+	Filter string `yaml:"filter"`
+	// Sparse lists the directories checked out, in sparse-checkout cone
+	// mode; files at the root are always checked out. Empty means all.
+	Sparse []string `yaml:"sparse"`
+	// MaxArchiveSize and MaxExtractSize limit, in bytes, the downloaded
+	// and extracted sizes of tarball clones.
+	MaxArchiveSize int64 `yaml:"maxArchiveSize"`
+	MaxExtractSize int64 `yaml:"maxExtractSize"`
+	// MaxRepoSize skips, or with WarnOnly only warns about, repositories
+	// whose GitHub disk usage is larger, in bytes.
+	MaxRepoSize int64 `yaml:"maxRepoSize"`
+	WarnOnly    bool  `yaml:"warnOnly"`
+	// DiskBudget caps, in bytes, the size of the clone root: refs whose
+	// repository would not fit are not cloned.
+	DiskBudget int64 `yaml:"diskBudget"`
+}
+
+// Root returns the clone root.
+func (c *Config) Root() (string, error) {
+	if c.Dir != "" {
+		return c.Dir, nil
+	}
+	pwd, err := os.Getwd()
+	if err != nil {
+		return "", fmt.Errorf("getwd: %s", err)
+	}
+	return pwd, nil
+}
+
+// Validate checks the backend of c.
+func (c *Config) Validate() error {
+	switch c.Backend {
+	case "", "exec", "go", "tarball":
+		return nil
+	}
+	return fmt.Errorf("unknown git backend %q, want exec, go or tarball", c.Backend)
+}
+
+// Network configures how clones reach GitHub: through Proxy, trusting the
+// PEM certificates of CAFile and presenting the client certificate of
+// CertFile and KeyFile. The git binary trusts only the CAFile
+// certificates; go-git trusts them in addition to the system ones.
+type Network struct {
+	Proxy    string
+	CAFile   string
+	CertFile string
+	KeyFile  string
+}
+
+// Cloner clones refs into the clone root of its Config.
+type Cloner struct {
+	Config
+	Network Network
+	// Token authenticates the clones.
+	Token func(ctx context.Context) (string, error)
+	// Client downloads tarballs; it must authenticate requests to APIURL,
+	// and only them.
+	Client *http.Client
+	// APIURL is the REST API serving tarballs, https://api.github.com by
+	// default.
+	APIURL string
+	// Logger receives the git output, slog.Default() when nil.
+	Logger *slog.Logger
+}
+
+// backend clones the ref of r into dir/r.Name, or updates the clone of a
+// previous run in path to the ref, giving up when ctx is done.
+type backend interface {
+	clone(ctx context.Context, cl *Cloner, r *discovery.Repo, dir string) error
+	update(ctx context.Context, cl *Cloner, r *discovery.Repo, path string) error
+}
+
+func (cl *Cloner) backend() (backend, error) {
+	switch cl.Backend {
+	case "", "exec":
+		return execGit{}, nil
+	case "go":
+		return goGit{}, nil
+	case "tarball":
+		return tarball{}, nil
+	}
+	return nil, cl.Validate()
+}
+
+func (cl *Cloner) logger(r *discovery.Repo) *slog.Logger {
+	l := cl.Logger
+	if l == nil {
+		l = slog.Default()
+	}
+	return l.With(r.Attrs()...)
+}
+
+func (cl *Cloner) token(ctx context.Context) (string, error) {
+	if cl.Token == nil {
+		return "", nil
+	}
+	return cl.Token(ctx)
+}
+
+func (cl *Cloner) client() *http.Client {
+	if cl.Client != nil {
+		return cl.Client
+	}
+	return &http.Client{Timeout: 30 * time.Minute}
+}
+
+// Clone clones r with the backend of the Config and returns the directory
+// of its working tree. A working tree left incomplete by a failed or
+// cancelled clone is removed, unless it existed beforehand. The working
+// tree of a previous run, recorded in the manifest, is updated to the ref
+// instead; other existing directories are left alone and are an error.
+func (cl *Cloner) Clone(ctx context.Context, r *discovery.Repo) (string, error) {
+	b, err := cl.backend()
+	if err != nil {
+		return "", fmt.Errorf("clone: %s", err)
+	}
+	root, err := cl.Root()
+	if err != nil {
+		return "", fmt.Errorf("clone: %s", err)
+	}
+	dir, err := createCloneDir(root, r)
+	if err != nil {
+		return "", fmt.Errorf("clone: %s", err)
+	}
+	path := filepath.Join(dir, r.Name)
+	_, statErr := os.Lstat(path)
+	if statErr == nil {
+		if err := updateClone(ctx, cl, b, root, path, r); err != nil {
+			return "", err
+		}
+	} else if err := b.clone(ctx, cl, r, dir); err != nil {
+		if os.IsNotExist(statErr) {
+			os.RemoveAll(path)
+			removeEmptyParents(root, dir)
+		}
+		return "", err
+	}
+	if err := recordClone(root, path, r); err != nil {
+		return "", fmt.Errorf("clone: %s", err)
+	}
+	return path, nil
+}
+
+// updateClone updates the working tree of r in path with b, provided the
+// manifest of root records it.
+func updateClone(ctx context.Context, cl *Cloner, b backend, root, path string, r *discovery.Repo) error {
+	m, err := loadManifest(root)
+	if err != nil {
+		return fmt.Errorf("clone: %s", err)
+	}
+	if m[r.CloneDir()] == nil {
+		return fmt.Errorf("clone: %s exists and is not in the manifest of %s", path, root)
+	}
+	return b.update(ctx, cl, r, path)
+}
+
+func createCloneDir(root string, r *discovery.Repo) (string, error) {
+	dir := filepath.Dir(filepath.Join(root, r.CloneDir()))
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return dir, fmt.Errorf("createCloneDir mkdirall: %s", err)
+	}
+	return dir, nil
+}
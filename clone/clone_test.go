@@ -0,0 +1,121 @@
+package clone
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/idletekz/go-graphql/discovery"
+)
+
+// commit writes file with data in the repository src and commits it.
+func commit(t *testing.T, src, file, data string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(src, file), []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, args := range [][]string{{"add", file}, {"commit", "-q", "-m", file}} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = src
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %s: %s\n%s", args[0], err, out)
+		}
+	}
+}
+
+func TestCloneTwice(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("no git binary")
+	}
+	t.Setenv("GIT_AUTHOR_NAME", "test")
+	t.Setenv("GIT_AUTHOR_EMAIL", "test@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "test")
+	t.Setenv("GIT_COMMITTER_EMAIL", "test@example.com")
+	for _, backend := range []string{"exec", "go"} {
+		t.Run(backend, func(t *testing.T) {
+			src := t.TempDir()
+			if out, err := exec.Command("git", "init", "-q", "-b", "main", src).CombinedOutput(); err != nil {
+				t.Fatalf("git init: %s\n%s", err, out)
+			}
+			commit(t, src, "props.yaml", "v1")
+			cl := &Cloner{Config: Config{Dir: t.TempDir(), Backend: backend}}
+			r := &discovery.Repo{Owner: "o", Name: "r", Branch: "main", Kind: discovery.KindBranch, URL: "file://" + src}
+			path, err := cl.Clone(context.Background(), r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(path, "untracked"), nil, 0644); err != nil {
+				t.Fatal(err)
+			}
+			commit(t, src, "props.yaml", "v2")
+			if _, err := cl.Clone(context.Background(), r); err != nil {
+				t.Fatalf("second clone: %s", err)
+			}
+			if data, err := os.ReadFile(filepath.Join(path, "props.yaml")); err != nil || string(data) != "v2" {
+				t.Errorf("props.yaml = %q, %v, want v2", data, err)
+			}
+			if _, err := os.Stat(filepath.Join(path, "untracked")); !os.IsNotExist(err) {
+				t.Errorf("untracked file kept: %v", err)
+			}
+		})
+	}
+}
+
+func TestCloneUnrecorded(t *testing.T) {
+	cl := &Cloner{Config: Config{Dir: t.TempDir()}}
+	r := &discovery.Repo{Owner: "o", Name: "r", Branch: "main", Kind: discovery.KindBranch}
+	path := filepath.Join(cl.Dir, r.CloneDir())
+	if err := os.MkdirAll(path, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cl.Clone(context.Background(), r); err == nil || !strings.Contains(err.Error(), "not in the manifest") {
+		t.Errorf("clone into an unrecorded directory = %v", err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("unrecorded directory removed: %s", err)
+	}
+}
+
+func TestCloneCancelled(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("no git binary")
+	}
+	// The server never answers, as a stalled transfer.
+	done := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-done:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(done)
+	for _, backend := range []string{"exec", "go"} {
+		t.Run(backend, func(t *testing.T) {
+			cl := &Cloner{Config: Config{Dir: t.TempDir(), Backend: backend}}
+			r := &discovery.Repo{Owner: "o", Name: "r", Branch: "main", Kind: discovery.KindBranch, URL: srv.URL + "/o/r.git"}
+			ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+			defer cancel()
+			start := time.Now()
+			if _, err := cl.Clone(ctx, r); err == nil {
+				t.Fatal("cancelled clone succeeded")
+			}
+			if d := time.Since(start); d > 3*time.Second {
+				t.Errorf("cancelled clone returned after %s", d)
+			}
+			entries, err := os.ReadDir(cl.Dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 0 {
+				t.Errorf("clone root holds %s after a cancelled clone", entries[0].Name())
+			}
+		})
+	}
+}
@@ -0,0 +1,6 @@
+//go:build !unix
+
+package clone
+
+// oNoFollow is not supported; os.O_EXCL alone refuses existing links.
+const oNoFollow = 0
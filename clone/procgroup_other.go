@@ -0,0 +1,11 @@
+//go:build !unix
+
+package clone
+
+import "os/exec"
+
+// killProcessGroup only bounds, without process groups, the wait for the
+// output of the helpers of a killed git.
+func killProcessGroup(cmd *exec.Cmd) {
+	cmd.WaitDelay = waitDelay
+}
@@ -0,0 +1,19 @@
+//go:build unix
+
+package clone
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// killProcessGroup makes cmd start a process group of its own and kills the
+// whole group when the context of cmd is done: git leaves the transfer to
+// helpers such as git-remote-https, which hold its output open.
+func killProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	cmd.WaitDelay = waitDelay
+}
@@ -0,0 +1,120 @@
+package clone
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/idletekz/go-graphql/discovery"
+)
+
+// manifestName is the file, at the clone root, recording the clones made
+// there. prune only ever removes directories recorded in it.
+const manifestName = ".clones.json"
+
+// manifest maps clone directories, relative to the clone root, to the ref
+// they were cloned from.
+type manifest map[string]*manifestEntry
+
+type manifestEntry struct {
+	Owner  string    `json:"owner"`
+	Name   string    `json:"name"`
+	Branch string    `json:"branch"`
+	SHA    string    `json:"sha"`
+	Cloned time.Time `json:"cloned"`
+}
+
+func loadManifest(root string) (manifest, error) {
+	m := make(manifest)
+	data, err := ioutil.ReadFile(filepath.Join(root, manifestName))
+	if os.IsNotExist(err) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("loadManifest: %s", err)
+	}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("loadManifest: %s", err)
+	}
+	return m, nil
+}
+
+func (m manifest) save(root string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(root, manifestName+".tmp")
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("manifest save: %s", err)
+	}
+	return os.Rename(tmp, filepath.Join(root, manifestName))
+}
+
+// recordClone adds the clone of r in dir to the manifest of root.
+func recordClone(root, dir string, r *discovery.Repo) error {
+	m, err := loadManifest(root)
+	if err != nil {
+		return err
+	}
+	rel, err := filepath.Rel(root, dir)
+	if err != nil {
+		return err
+	}
+	m[rel] = &manifestEntry{Owner: r.Owner, Name: r.Name, Branch: r.Branch, SHA: r.SHA, Cloned: time.Now()}
+	return m.save(root)
+}
+
+// Prune removes the clone directories of root whose ref is not in active,
+// because it was deleted or saw no recent commit, and lists them on w. With
+// dryRun set, they are only listed.
+func Prune(root string, active []*discovery.Repo, dryRun bool, w io.Writer) error {
+	m, err := loadManifest(root)
+	if err != nil {
+		return err
+	}
+	keep := make(map[string]bool)
+	for _, r := range active {
+		keep[r.CloneDir()] = true
+	}
+	var stale []string
+	for rel := range m {
+		if !keep[rel] {
+			stale = append(stale, rel)
+		}
+	}
+	sort.Strings(stale)
+	for _, rel := range stale {
+		e := m[rel]
+		if dryRun {
+			fmt.Fprintf(w, "would remove %s (%s/%s@%s)\n", rel, e.Owner, e.Name, e.Branch)
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(root, rel)); err != nil {
+			return fmt.Errorf("prune: %s", err)
+		}
+		removeEmptyParents(root, filepath.Dir(filepath.Join(root, rel)))
+		delete(m, rel)
+		fmt.Fprintf(w, "removed %s (%s/%s@%s)\n", rel, e.Owner, e.Name, e.Branch)
+	}
+	if dryRun || len(stale) == 0 {
+		return nil
+	}
+	return m.save(root)
+}
+
+// removeEmptyParents removes dir and its parents, up to root, while they
+// are empty.
+func removeEmptyParents(root, dir string) {
+	for dir != root && len(dir) > len(root) {
+		if err := os.Remove(dir); err != nil {
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
@@ -0,0 +1,127 @@
+package clone
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/idletekz/go-graphql/discovery"
+)
+
+// Quota applies the size limits of a Config. GitHub reports the disk
+// usage of the whole repository, an upper bound of the size of a shallow
+// clone, so refs are admitted on that estimate and accounted for with the
+// actual size of their clone. Clones of previous runs, updated in place,
+// are charged only for their growth.
+type Quota struct {
+	maxRepo  int64
+	warnOnly bool
+	budget   int64
+	used     int64
+	root     string
+	sizes    map[string]int64 // by clone directory, relative to root
+}
+
+// NewQuota returns the Quota of c, measuring the clone root and the clones
+// of its manifest when a disk budget is set.
+func NewQuota(c *Config) (*Quota, error) {
+	q := &Quota{maxRepo: c.MaxRepoSize, warnOnly: c.WarnOnly, budget: c.DiskBudget}
+	if q.budget == 0 {
+		return q, nil
+	}
+	root, err := c.Root()
+	if err != nil {
+		return nil, fmt.Errorf("NewQuota: %s", err)
+	}
+	if q.used, err = dirSize(root); err != nil {
+		return nil, fmt.Errorf("NewQuota: %s", err)
+	}
+	m, err := loadManifest(root)
+	if err != nil {
+		return nil, fmt.Errorf("NewQuota: %s", err)
+	}
+	q.root = root
+	q.sizes = make(map[string]int64, len(m))
+	for rel := range m {
+		if q.sizes[rel], err = dirSize(filepath.Join(root, rel)); err != nil {
+			return nil, fmt.Errorf("NewQuota: %s", err)
+		}
+	}
+	return q, nil
+}
+
+// Admit returns an error when r must not be cloned.
+func (q *Quota) Admit(r *discovery.Repo) error {
+	if q.maxRepo > 0 && r.Size > q.maxRepo {
+		if !q.warnOnly {
+			return fmt.Errorf("%s/%s is %s, above the %s limit", r.Owner, r.Name, byteSize(r.Size), byteSize(q.maxRepo))
+		}
+		slog.With(r.Attrs()...).Warn("repository above the size limit, cloning anyway", "size", r.Size, "limit", q.maxRepo)
+	}
+	if q.budget > 0 && q.used-q.sizes[r.CloneDir()]+r.Size > q.budget {
+		return fmt.Errorf("%s/%s@%s (%s) does not fit in the disk budget: %s of %s used",
+			r.Owner, r.Name, r.Branch, byteSize(r.Size), byteSize(q.used), byteSize(q.budget))
+	}
+	return nil
+}
+
+// Add accounts for the clone in dir, charging only its growth when it was
+// already accounted for.
+func (q *Quota) Add(dir string) {
+	if q.budget == 0 {
+		return
+	}
+	size, err := dirSize(dir)
+	if err != nil {
+		slog.Warn("quota: cannot measure clone", "dir", dir, "err", err)
+	}
+	rel, err := filepath.Rel(q.root, dir)
+	if err != nil {
+		rel = dir
+	}
+	q.used += size - q.sizes[rel]
+	q.sizes[rel] = size
+}
+
+// Assume accounts for r as if cloned, at its GitHub disk usage, to plan
+// clones without making them.
+func (q *Quota) Assume(r *discovery.Repo) {
+	if q.budget == 0 {
+		return
+	}
+	q.used += r.Size - q.sizes[r.CloneDir()]
+	q.sizes[r.CloneDir()] = r.Size
+}
+
+// dirSize returns the total size of the regular files below dir.
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == dir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
+
+// byteSize formats n bytes with a binary unit.
+func byteSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,52 @@
+package clone
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/idletekz/go-graphql/discovery"
+)
+
+func TestQuotaUpdatedClone(t *testing.T) {
+	root := t.TempDir()
+	r := &discovery.Repo{Owner: "o", Name: "r", Branch: "main", Size: 1000}
+	dir := filepath.Join(root, r.CloneDir())
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, "data")
+	if err := os.WriteFile(file, make([]byte, 1000), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := recordClone(root, dir, r); err != nil {
+		t.Fatal(err)
+	}
+	size, err := dirSize(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q, err := NewQuota(&Config{Dir: root, DiskBudget: size + 500})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Admit(r); err != nil {
+		t.Errorf("update of a clone counted twice: %s", err)
+	}
+	other := &discovery.Repo{Owner: "o", Name: "other", Branch: "main", Size: 1000}
+	if err := q.Admit(other); err == nil || !strings.Contains(err.Error(), "disk budget") {
+		t.Errorf("Admit(other) = %v, want a budget error", err)
+	}
+	if err := os.WriteFile(file, make([]byte, 1200), 0644); err != nil {
+		t.Fatal(err)
+	}
+	q.Add(dir)
+	if q.used != size+200 {
+		t.Errorf("used = %d after growing the clone by 200, want %d", q.used, size+200)
+	}
+	q.Add(dir)
+	if q.used != size+200 {
+		t.Errorf("used = %d after adding the clone again, want %d", q.used, size+200)
+	}
+}
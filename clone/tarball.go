@@ -0,0 +1,246 @@
+package clone
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/idletekz/go-graphql/discovery"
+)
+
+// Default size limits of the tarball backend.
+const (
+	defaultMaxArchiveSize = 1 << 30 // compressed
+	defaultMaxExtractSize = 2 << 30 // extracted
+)
+
+var errTooLarge = errors.New("size limit exceeded")
+
+// tarball downloads the ref of r as a gzipped tar archive, from the REST
+// tarball endpoint, and extracts it: a working tree without git history,
+// for read-only analysis. Partial clone filters do not apply; sparse
+// directories are honoured as by git in cone mode.
+type tarball struct{}
+
+func (tarball) clone(ctx context.Context, cl *Cloner, r *discovery.Repo, dir string) error {
+	c := &cl.Config
+	api := cl.APIURL
+	if api == "" {
+		api = "https://api.github.com"
+	}
+	url := fmt.Sprintf("%s/repos/%s/%s/tarball/%s", api, r.Owner, r.Name, r.Rev())
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return err
+	}
+	res, err := cl.client().Do(req)
+	if err != nil {
+		return fmt.Errorf("tarball: %s", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("tarball status code: %v", res.StatusCode)
+	}
+	maxArchive := c.MaxArchiveSize
+	if maxArchive == 0 {
+		maxArchive = defaultMaxArchiveSize
+	}
+	gz, err := gzip.NewReader(&limitReader{r: res.Body, n: maxArchive})
+	if err != nil {
+		return fmt.Errorf("tarball: %s", err)
+	}
+	// The archive is extracted into a new directory, replacing the working
+	// tree of a previous run once complete.
+	tmp, err := os.MkdirTemp(dir, "."+r.Name+".tmp")
+	if err != nil {
+		return fmt.Errorf("tarball: %s", err)
+	}
+	defer os.RemoveAll(tmp)
+	if err := extract(tar.NewReader(gz), tmp, c); err != nil {
+		return fmt.Errorf("tarball %s/%s@%s: %s", r.Owner, r.Name, r.Branch, err)
+	}
+	path := filepath.Join(dir, r.Name)
+	if err := os.RemoveAll(path); err != nil {
+		return fmt.Errorf("tarball: %s", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("tarball: %s", err)
+	}
+	return nil
+}
+
+// update downloads the ref of r again, replacing the working tree in path.
+func (t tarball) update(ctx context.Context, cl *Cloner, r *discovery.Repo, path string) error {
+	return t.clone(ctx, cl, r, filepath.Dir(path))
+}
+
+// extract writes the regular files, directories and symbolic links of tr
+// below root, stripping the top level directory GitHub wraps them in.
+// Entries escaping root, written through or over a link, and links that
+// could point outside of it are rejected.
+func extract(tr *tar.Reader, root string, c *Config) error {
+	maxExtract := c.MaxExtractSize
+	if maxExtract == 0 {
+		maxExtract = defaultMaxExtractSize
+	}
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return err
+	}
+	var written int64
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		i := strings.Index(hdr.Name, "/")
+		if i < 0 {
+			continue
+		}
+		rel := strings.TrimSuffix(hdr.Name[i+1:], "/")
+		if rel == "" || !sparseMatch(c.Sparse, rel) {
+			continue
+		}
+		target, err := securePath(root, rel)
+		if err != nil {
+			return err
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(target, 0755)
+		case tar.TypeReg:
+			if written += hdr.Size; written > maxExtract {
+				return errTooLarge
+			}
+			err = writeFile(target, tr, hdr)
+		case tar.TypeSymlink:
+			if err := checkLink(rel, hdr.Linkname); err != nil {
+				return err
+			}
+			if err = os.MkdirAll(filepath.Dir(target), 0755); err == nil {
+				err = os.Symlink(hdr.Linkname, target)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// writeFile creates path with the content of r. It fails when path exists,
+// notably as a link.
+func writeFile(path string, r io.Reader, hdr *tar.Header) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY|oNoFollow, hdr.FileInfo().Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.CopyN(f, r, hdr.Size); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// securePath joins rel to root, rejecting paths that leave root, lexically
+// or through a symbolic link extracted earlier, and paths of such links.
+func securePath(root, rel string) (string, error) {
+	clean := filepath.Clean(filepath.FromSlash(rel))
+	if filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s: path escapes the clone directory", rel)
+	}
+	parent := root
+	for _, elem := range strings.Split(filepath.Dir(clean), string(filepath.Separator)) {
+		if elem == "." {
+			break
+		}
+		parent = filepath.Join(parent, elem)
+		if fi, err := os.Lstat(parent); err == nil && fi.Mode()&os.ModeSymlink != 0 {
+			return "", fmt.Errorf("%s: path goes through the link %s", rel, parent)
+		}
+	}
+	target := filepath.Join(root, clean)
+	if fi, err := os.Lstat(target); err == nil && fi.Mode()&os.ModeSymlink != 0 {
+		return "", fmt.Errorf("%s: path is a link", rel)
+	}
+	return target, nil
+}
+
+// checkLink rejects the target link of a symbolic link at rel that could
+// resolve outside of the clone directory. Its ".." elements must all lead,
+// without climbing above the clone directory: the directory of the link
+// holds no link, so they resolve lexically. The rest of the target only
+// descends, through directories or links checked the same way, so it
+// cannot climb back out, whatever links it goes through.
+func checkLink(rel, link string) error {
+	if filepath.IsAbs(link) {
+		return fmt.Errorf("%s: absolute link to %s", rel, link)
+	}
+	depth := strings.Count(filepath.Clean(filepath.FromSlash(rel)), string(filepath.Separator))
+	descended := false
+	for _, elem := range strings.Split(filepath.FromSlash(link), string(filepath.Separator)) {
+		switch elem {
+		case "", ".":
+		case "..":
+			if descended {
+				return fmt.Errorf("%s: link to %s climbs back up", rel, link)
+			}
+			if depth--; depth < 0 {
+				return fmt.Errorf("%s: link to %s escapes the clone directory", rel, link)
+			}
+		default:
+			descended = true
+		}
+	}
+	return nil
+}
+
+// sparseMatch reports whether rel is checked out given the sparse
+// directories: root files and anything below a listed directory, or
+// everything when none are listed.
+func sparseMatch(sparse []string, rel string) bool {
+	if len(sparse) == 0 || !strings.Contains(rel, "/") {
+		return true
+	}
+	for _, dir := range sparse {
+		dir = strings.Trim(dir, "/")
+		if rel == dir || strings.HasPrefix(rel, dir+"/") || strings.HasPrefix(dir, rel+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// limitReader reads from r until n bytes were read, then fails with
+// errTooLarge.
+type limitReader struct {
+	r io.Reader
+	n int64
+}
+
+func (l *limitReader) Read(p []byte) (int, error) {
+	if l.n <= 0 {
+		var b [1]byte
+		if n, err := l.r.Read(b[:]); n == 0 && err != nil {
+			return 0, err
+		}
+		return 0, errTooLarge
+	}
+	if int64(len(p)) > l.n {
+		p = p[:l.n]
+	}
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	return n, err
+}
@@ -0,0 +1,174 @@
+package clone
+
+import (
+	"archive/tar"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// entry is a tar archive entry: a directory when name ends with "/", a
+// symbolic link when link is set, a regular file otherwise.
+type entry struct {
+	name, link, data string
+}
+
+func archive(t *testing.T, entries ...entry) *tar.Reader {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Mode: 0644, Typeflag: tar.TypeReg, Size: int64(len(e.data))}
+		switch {
+		case e.link != "":
+			hdr.Typeflag, hdr.Linkname, hdr.Size = tar.TypeSymlink, e.link, 0
+		case e.name[len(e.name)-1] == '/':
+			hdr.Typeflag, hdr.Mode, hdr.Size = tar.TypeDir, 0755, 0
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(e.data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return tar.NewReader(&buf)
+}
+
+func TestExtract(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "clone")
+	tr := archive(t,
+		entry{name: "top/"},
+		entry{name: "top/README.md", data: "readme"},
+		entry{name: "top/docs/"},
+		entry{name: "top/docs/index.md", data: "index"},
+		entry{name: "top/docs/readme", link: "../README.md"},
+		entry{name: "top/src/main.go", data: "package main"},
+	)
+	if err := extract(tr, root, &Config{Sparse: []string{"docs"}}); err != nil {
+		t.Fatal(err)
+	}
+	for path, want := range map[string]string{"README.md": "readme", "docs/index.md": "index", "docs/readme": "readme"} {
+		data, err := os.ReadFile(filepath.Join(root, path))
+		if err != nil {
+			t.Errorf("%s: %s", path, err)
+		} else if string(data) != want {
+			t.Errorf("%s = %q, want %q", path, data, want)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(root, "src")); !os.IsNotExist(err) {
+		t.Errorf("src outside of the sparse directories was extracted")
+	}
+}
+
+func TestExtractEscapes(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []entry
+	}{
+		{"dot dot", []entry{{name: "top/../victim", data: "x"}}},
+		{"absolute link", []entry{{name: "top/a", link: "/etc/passwd"}}},
+		{"link out", []entry{{name: "top/a", link: "../victim"}}},
+		{"link out of subdirectory", []entry{{name: "top/d/a", link: "../../victim"}}},
+		{"write through link", []entry{
+			{name: "top/d", link: "."},
+			{name: "top/d/victim", data: "x"},
+		}},
+		{"write over link", []entry{
+			{name: "top/a", link: "b"},
+			{name: "top/a", data: "x"},
+		}},
+		{"climb through link", []entry{
+			{name: "top/b", link: "."},
+			{name: "top/a", link: "b/../victim"},
+			{name: "top/a", data: "x"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			root := filepath.Join(dir, "clone")
+			if err := extract(archive(t, tt.entries...), root, &Config{}); err == nil {
+				t.Errorf("extract succeeded")
+			}
+			if _, err := os.Lstat(filepath.Join(dir, "victim")); !os.IsNotExist(err) {
+				t.Errorf("victim written outside of the clone directory")
+			}
+		})
+	}
+}
+
+func TestCheckLink(t *testing.T) {
+	tests := []struct {
+		rel, link string
+		ok        bool
+	}{
+		{"a", "b", true},
+		{"a", "./b/c", true},
+		{"d/a", "../b", true},
+		{"d/e/a", "../../b/c", true},
+		{"a", ".", true},
+		{"a", "..", false},
+		{"d/a", "../../b", false},
+		{"a", "b/../c", false},
+		{"d/a", "../b/../../c", false},
+		{"a", "/b", false},
+	}
+	for _, tt := range tests {
+		if err := checkLink(tt.rel, tt.link); (err == nil) != tt.ok {
+			t.Errorf("checkLink(%q, %q) = %v, want ok %v", tt.rel, tt.link, err, tt.ok)
+		}
+	}
+}
+
+func TestSecurePath(t *testing.T) {
+	root := t.TempDir()
+	if err := os.Symlink(".", filepath.Join(root, "link")); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		rel string
+		ok  bool
+	}{
+		{"a", true},
+		{"a/b/c", true},
+		{"a/../b", true},
+		{"..", false},
+		{"../a", false},
+		{"a/../../b", false},
+		{"link", false},
+		{"link/a", false},
+	}
+	for _, tt := range tests {
+		if _, err := securePath(root, tt.rel); (err == nil) != tt.ok {
+			t.Errorf("securePath(%q) = %v, want ok %v", tt.rel, err, tt.ok)
+		}
+	}
+}
+
+func TestSparseMatch(t *testing.T) {
+	tests := []struct {
+		sparse []string
+		rel    string
+		want   bool
+	}{
+		{nil, "a/b", true},
+		{[]string{"docs"}, "README.md", true},
+		{[]string{"docs"}, "docs", true},
+		{[]string{"docs"}, "docs/a/b", true},
+		{[]string{"docs/"}, "docs/a", true},
+		{[]string{"docs/api"}, "docs", true},
+		{[]string{"docs/api"}, "docs/other/a", false},
+		{[]string{"docs"}, "documents/a", false},
+		{[]string{"docs"}, "src/a", false},
+	}
+	for _, tt := range tests {
+		if got := sparseMatch(tt.sparse, tt.rel); got != tt.want {
+			t.Errorf("sparseMatch(%q, %q) = %v, want %v", tt.sparse, tt.rel, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,444 @@
+// Command graphqlgen generates typed Go code for GraphQL operations.
+//
+// It reads a schema and .graphql files holding operations and fragments,
+// validates them against the schema, and writes:
+//
+//	type F            // for every fragment F, the fields it selects
+//	const FFragment   // the fragment document, for hand-built queries
+//	const OpQuery     // for every operation Op, its document and fragments
+//	type OpResponse   // the data returned by Op
+//	type OpVariables  // the variables of Op, if any, with a Set method
+//
+// Enums used by the selected fields and variables become string types with
+// one constant per value. Selections made through inline fragments are
+// flattened into the enclosing struct, as in the JSON response, merging the
+// sub-selections of a field selected by several of them; fragment
+// spreads are embedded, and a selection made of a single fragment spread is
+// typed as the fragment itself.
+//
+// Usage:
+//
+//	graphqlgen -schema graphql/schema.graphql -out graphql_gen.go graphql/*.graphql
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/vektah/gqlparser/v2"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/formatter"
+	"github.com/vektah/gqlparser/v2/parser"
+	"github.com/vektah/gqlparser/v2/validator"
+	"github.com/vektah/gqlparser/v2/validator/rules"
+)
+
+func main() {
+	schemaPath := flag.String("schema", "graphql/schema.graphql", "GraphQL schema file")
+	out := flag.String("out", "graphql_gen.go", "generated Go file")
+	pkg := flag.String("package", "main", "package of the generated file")
+	flag.Parse()
+	src, err := generate(*schemaPath, flag.Args(), *pkg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := ioutil.WriteFile(*out, src, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// scalars maps GraphQL scalars to Go types.
+var scalars = map[string]string{
+	"Boolean":         "bool",
+	"Float":           "float64",
+	"ID":              "string",
+	"Int":             "int",
+	"String":          "string",
+	"Base64String":    "string",
+	"Date":            "string",
+	"DateTime":        "time.Time",
+	"GitObjectID":     "string",
+	"GitRefname":      "string",
+	"GitSSHRemote":    "string",
+	"GitTimestamp":    "time.Time",
+	"HTML":            "string",
+	"PreciseDateTime": "time.Time",
+	"URI":             "string",
+	"X509Certificate": "string",
+}
+
+// initialisms are written upper case in Go names.
+var initialisms = map[string]bool{
+	"API": true, "HTML": true, "HTTP": true, "ID": true, "JSON": true,
+	"OID": true, "SHA": true, "SSH": true, "URI": true, "URL": true,
+}
+
+type generator struct {
+	schema *ast.Schema
+	doc    *ast.QueryDocument
+	enums  map[string]bool
+	time   bool
+	buf    bytes.Buffer
+}
+
+func generate(schemaPath string, paths []string, pkg string) ([]byte, error) {
+	schemaSrc, err := ioutil.ReadFile(schemaPath)
+	if err != nil {
+		return nil, err
+	}
+	schema, err := gqlparser.LoadSchema(&ast.Source{Name: schemaPath, Input: string(schemaSrc)})
+	if err != nil {
+		return nil, err
+	}
+	doc := &ast.QueryDocument{}
+	for _, path := range paths {
+		if filepath.Clean(path) == filepath.Clean(schemaPath) {
+			continue
+		}
+		src, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		d, err := parser.ParseQuery(&ast.Source{Name: path, Input: string(src)})
+		if err != nil {
+			return nil, err
+		}
+		doc.Operations = append(doc.Operations, d.Operations...)
+		doc.Fragments = append(doc.Fragments, d.Fragments...)
+	}
+	// Fragments may only be used by hand-built queries.
+	r := rules.NewDefaultRules()
+	r.RemoveRule(rules.NoUnusedFragmentsRule.Name)
+	if errs := validator.ValidateWithRules(schema, doc, r); len(errs) > 0 {
+		return nil, errs
+	}
+
+	g := &generator{schema: schema, doc: doc, enums: make(map[string]bool)}
+	for _, f := range doc.Fragments {
+		if err := g.fragment(f); err != nil {
+			return nil, err
+		}
+	}
+	for _, op := range doc.Operations {
+		if err := g.operation(op); err != nil {
+			return nil, err
+		}
+	}
+	g.writeEnums()
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "// Code generated by graphqlgen. DO NOT EDIT.\n\npackage %s\n\nimport (\n", pkg)
+	if g.time {
+		fmt.Fprintf(&out, "\t\"time\"\n\n")
+	}
+	fmt.Fprintf(&out, "\t\"github.com/machinebox/graphql\"\n)\n")
+	out.Write(g.buf.Bytes())
+	src, err := format.Source(out.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("format: %s\n%s", err, out.Bytes())
+	}
+	return src, nil
+}
+
+func (g *generator) fragment(f *ast.FragmentDefinition) error {
+	typ, err := g.structOf(f.SelectionSet, false)
+	if err != nil {
+		return fmt.Errorf("fragment %s: %s", f.Name, err)
+	}
+	fmt.Fprintf(&g.buf, "\n// %s is selected by fragment %s on %s.\ntype %s %s\n", f.Name, f.Name, f.TypeCondition, f.Name, typ)
+	fmt.Fprintf(&g.buf, "\n// %sFragment is the document of fragment %s.\nconst %sFragment = %s\n",
+		f.Name, f.Name, f.Name, quote(g.format(&ast.QueryDocument{Fragments: g.fragments(f.SelectionSet, nil)}, f)))
+	return nil
+}
+
+func (g *generator) operation(op *ast.OperationDefinition) error {
+	if op.Name == "" {
+		return fmt.Errorf("%s: operations must be named", op.Position.Src.Name)
+	}
+	typ, err := g.structOf(op.SelectionSet, true)
+	if err != nil {
+		return fmt.Errorf("%s %s: %s", op.Operation, op.Name, err)
+	}
+	doc := &ast.QueryDocument{
+		Operations: ast.OperationList{op},
+		Fragments:  g.fragments(op.SelectionSet, nil),
+	}
+	fmt.Fprintf(&g.buf, "\n// %sQuery is the document of %s %s.\nconst %sQuery = %s\n", op.Name, op.Operation, op.Name, op.Name, quote(g.format(doc, nil)))
+	fmt.Fprintf(&g.buf, "\n// %sResponse is the data returned by %s %s.\ntype %sResponse %s\n", op.Name, op.Operation, op.Name, op.Name, typ)
+
+	if len(op.VariableDefinitions) == 0 {
+		return nil
+	}
+	var fields, set strings.Builder
+	for _, v := range op.VariableDefinitions {
+		typ, err := g.varType(v.Type)
+		if err != nil {
+			return fmt.Errorf("%s %s: $%s: %s", op.Operation, op.Name, v.Variable, err)
+		}
+		name := goName(v.Variable)
+		fmt.Fprintf(&fields, "%s %s\n", name, typ)
+		switch {
+		case v.Type.NonNull:
+			fmt.Fprintf(&set, "req.Var(%q, v.%s)\n", v.Variable, name)
+		case v.Type.Elem != nil:
+			fmt.Fprintf(&set, "if v.%s != nil {\nreq.Var(%q, v.%s)\n}\n", name, v.Variable, name)
+		default:
+			fmt.Fprintf(&set, "if v.%s != nil {\nreq.Var(%q, *v.%s)\n}\n", name, v.Variable, name)
+		}
+	}
+	fmt.Fprintf(&g.buf, "\n// %sVariables are the variables of %s %s.\ntype %sVariables struct {\n%s}\n", op.Name, op.Operation, op.Name, op.Name, fields.String())
+	fmt.Fprintf(&g.buf, "\n// Set assigns the variables to req, leaving out unset optional ones.\nfunc (v *%sVariables) Set(req *graphql.Request) {\n%s}\n", op.Name, set.String())
+	return nil
+}
+
+// format prints doc, followed by the fragment f when it is not nil.
+func (g *generator) format(doc *ast.QueryDocument, f *ast.FragmentDefinition) string {
+	if f != nil {
+		doc.Fragments = append(ast.FragmentDefinitionList{f}, doc.Fragments...)
+	}
+	var b bytes.Buffer
+	formatter.NewFormatter(&b, formatter.WithIndent("  ")).FormatQueryDocument(doc)
+	return strings.TrimSpace(b.String())
+}
+
+// fragments returns the fragments spread in sel, transitively, in document
+// order.
+func (g *generator) fragments(sel ast.SelectionSet, used map[string]bool) ast.FragmentDefinitionList {
+	top := used == nil
+	if top {
+		used = make(map[string]bool)
+	}
+	for _, s := range sel {
+		switch s := s.(type) {
+		case *ast.Field:
+			g.fragments(s.SelectionSet, used)
+		case *ast.InlineFragment:
+			g.fragments(s.SelectionSet, used)
+		case *ast.FragmentSpread:
+			if !used[s.Name] {
+				used[s.Name] = true
+				g.fragments(s.Definition.SelectionSet, used)
+			}
+		}
+	}
+	if !top {
+		return nil
+	}
+	var list ast.FragmentDefinitionList
+	for _, f := range g.doc.Fragments {
+		if used[f.Name] {
+			list = append(list, f)
+		}
+	}
+	return list
+}
+
+// structOf returns the Go type of the selection sel. Unless top is set, a
+// selection of a single fragment spread is typed as that fragment.
+func (g *generator) structOf(sel ast.SelectionSet, top bool) (string, error) {
+	if len(sel) == 1 && !top {
+		if s, ok := sel[0].(*ast.FragmentSpread); ok {
+			return s.Name, nil
+		}
+	}
+	var b strings.Builder
+	b.WriteString("struct {\n")
+	if err := g.fields(&b, sel); err != nil {
+		return "", err
+	}
+	b.WriteString("}")
+	return b.String(), nil
+}
+
+// member is a field or a fragment spread of a struct. A field selected
+// more than once, e.g. by several inline fragments, is a single member
+// whose selection is the union of theirs.
+type member struct {
+	field  *ast.Field
+	sel    ast.SelectionSet
+	spread string
+}
+
+// members returns the members of sel, in selection order, flattening its
+// inline fragments into it.
+func members(list []*member, sel ast.SelectionSet) ([]*member, error) {
+	for _, s := range sel {
+		switch s := s.(type) {
+		case *ast.Field:
+			i := slices.IndexFunc(list, func(m *member) bool { return m.field != nil && m.field.Alias == s.Alias })
+			if i < 0 {
+				list = append(list, &member{field: s, sel: slices.Clone(s.SelectionSet)})
+				continue
+			}
+			m := list[i]
+			if a, b := m.field.Definition.Type.String(), s.Definition.Type.String(); a != b {
+				return nil, fmt.Errorf("%s: selected as both %s and %s", s.Alias, a, b)
+			}
+			m.sel = append(m.sel, s.SelectionSet...)
+		case *ast.InlineFragment:
+			var err error
+			if list, err = members(list, s.SelectionSet); err != nil {
+				return nil, err
+			}
+		case *ast.FragmentSpread:
+			if !slices.ContainsFunc(list, func(m *member) bool { return m.spread == s.Name }) {
+				list = append(list, &member{spread: s.Name})
+			}
+		}
+	}
+	return list, nil
+}
+
+func (g *generator) fields(b *strings.Builder, sel ast.SelectionSet) error {
+	list, err := members(nil, sel)
+	if err != nil {
+		return err
+	}
+	for _, m := range list {
+		if m.field == nil {
+			fmt.Fprintf(b, "%s\n", m.spread)
+			continue
+		}
+		typ, err := g.typeOf(m.field.Definition.Type, m.sel)
+		if err != nil {
+			return fmt.Errorf("%s: %s", m.field.Alias, err)
+		}
+		fmt.Fprintf(b, "%s %s `json:\"%s\"`\n", goName(m.field.Alias), typ, m.field.Alias)
+	}
+	return nil
+}
+
+// typeOf returns the Go type of a selected field. Lists of objects hold
+// pointers; nullable fields otherwise decode to their zero value.
+func (g *generator) typeOf(t *ast.Type, sel ast.SelectionSet) (string, error) {
+	if t.Elem != nil {
+		elem, err := g.typeOf(t.Elem, sel)
+		if err != nil {
+			return "", err
+		}
+		if len(sel) > 0 && t.Elem.Elem == nil {
+			return "[]*" + elem, nil
+		}
+		return "[]" + elem, nil
+	}
+	def := g.schema.Types[t.NamedType]
+	if def == nil {
+		return "", fmt.Errorf("unknown type %s", t.NamedType)
+	}
+	switch def.Kind {
+	case ast.Object, ast.Interface, ast.Union:
+		return g.structOf(sel, false)
+	}
+	return g.leafType(def)
+}
+
+// varType returns the Go type of a variable; nullable scalars and enums are
+// pointers so that they can be left unset.
+func (g *generator) varType(t *ast.Type) (string, error) {
+	if t.Elem != nil {
+		elem := t.Elem
+		if elem.Elem != nil {
+			return "", fmt.Errorf("nested lists are not supported")
+		}
+		def := g.schema.Types[elem.NamedType]
+		if def == nil {
+			return "", fmt.Errorf("unknown type %s", elem.NamedType)
+		}
+		typ, err := g.leafType(def)
+		return "[]" + typ, err
+	}
+	def := g.schema.Types[t.NamedType]
+	if def == nil {
+		return "", fmt.Errorf("unknown type %s", t.NamedType)
+	}
+	typ, err := g.leafType(def)
+	if err != nil || t.NonNull {
+		return typ, err
+	}
+	return "*" + typ, nil
+}
+
+func (g *generator) leafType(def *ast.Definition) (string, error) {
+	switch def.Kind {
+	case ast.Scalar:
+		typ, ok := scalars[def.Name]
+		if !ok {
+			return "", fmt.Errorf("no Go type for scalar %s", def.Name)
+		}
+		if typ == "time.Time" {
+			g.time = true
+		}
+		return typ, nil
+	case ast.Enum:
+		g.enums[def.Name] = true
+		return def.Name, nil
+	}
+	return "", fmt.Errorf("unsupported %s type %s", strings.ToLower(string(def.Kind)), def.Name)
+}
+
+func (g *generator) writeEnums() {
+	var names []string
+	for name := range g.enums {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		def := g.schema.Types[name]
+		fmt.Fprintf(&g.buf, "\n// %s is the GraphQL enum %s.\ntype %s string\n\n// %s values.\nconst (\n", name, name, name, name)
+		for _, v := range def.EnumValues {
+			fmt.Fprintf(&g.buf, "%s%s %s = %q\n", name, goName(strings.ToLower(v.Name)), name, v.Name)
+		}
+		g.buf.WriteString(")\n")
+	}
+}
+
+// goName exports a GraphQL name: sshUrl becomes SSHURL, ORGANIZATION_MEMBER
+// (lower cased) becomes OrganizationMember.
+func goName(name string) string {
+	var words []string
+	var word []rune
+	for _, r := range name {
+		switch {
+		case r == '_':
+			if len(word) > 0 {
+				words = append(words, string(word))
+			}
+			word = nil
+			continue
+		case unicode.IsUpper(r) && len(word) > 0 && !unicode.IsUpper(word[len(word)-1]):
+			words = append(words, string(word))
+			word = nil
+		}
+		word = append(word, r)
+	}
+	if len(word) > 0 {
+		words = append(words, string(word))
+	}
+	var b strings.Builder
+	for _, w := range words {
+		if initialisms[strings.ToUpper(w)] {
+			b.WriteString(strings.ToUpper(w))
+			continue
+		}
+		r := []rune(w)
+		b.WriteString(string(unicode.ToUpper(r[0])) + string(r[1:]))
+	}
+	return b.String()
+}
+
+// quote returns s as a raw string literal when possible.
+func quote(s string) string {
+	if strings.Contains(s, "`") {
+		return fmt.Sprintf("%q", s)
+	}
+	return "`\n" + s + "\n`"
+}
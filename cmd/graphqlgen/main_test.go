@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGoName(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"name", "Name"},
+		{"sshUrl", "SSHURL"},
+		{"repositoryId", "RepositoryID"},
+		{"oid", "OID"},
+		{"id", "ID"},
+		{"headSha", "HeadSHA"},
+		{"isFork", "IsFork"},
+		{"PUBLIC", "PUBLIC"},
+		{"organization_member", "OrganizationMember"},
+		{"_private", "Private"},
+		{"htmlUrl", "HTMLURL"},
+		{"committedDate", "CommittedDate"},
+	}
+	for _, tt := range tests {
+		if got := goName(tt.in); got != tt.want {
+			t.Errorf("goName(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestQuote(t *testing.T) {
+	if got := quote("a\nb"); got != "`\na\nb\n`" {
+		t.Errorf("quote = %q, want a raw string literal", got)
+	}
+	if got := quote("a`b"); got != `"a`+"`"+`b"` {
+		t.Errorf("quote = %q, want an interpreted string literal", got)
+	}
+}
+
+// TestGenerateUpToDate checks that the gql package matches its operations,
+// in the order of its go:generate directive: run go generate ./gql after
+// editing them.
+func TestGenerateUpToDate(t *testing.T) {
+	src, err := os.ReadFile("../../gql/gql.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for _, line := range strings.Split(string(src), "\n") {
+		if !strings.HasPrefix(line, "//go:generate ") {
+			continue
+		}
+		for _, arg := range strings.Fields(line) {
+			if strings.HasSuffix(arg, ".graphql") && !strings.HasSuffix(arg, "schema.graphql") {
+				paths = append(paths, filepath.Join("../../gql", arg))
+			}
+		}
+	}
+	got, err := generate("../../graphql/schema.graphql", paths, "gql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := os.ReadFile("../../gql/graphql_gen.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("gql/graphql_gen.go is out of date, run go generate ./gql")
+	}
+}
+
+func TestGenerateMergesFields(t *testing.T) {
+	tests := []struct {
+		query string
+		want  []string // in the generated code, spaces collapsed
+		err   bool
+	}{
+		{
+			query: `query Q { search(query: "x", type: ISSUE, first: 1) { nodes {
+  ... on Issue { author { login } }
+  ... on PullRequest { author { avatarUrl } }
+} } }`,
+			want: []string{"Author struct { Login string `json:\"login\"` AvatarURL string `json:\"avatarUrl\"` } `json:\"author\"`"},
+		},
+		{
+			query: `query Q { search(query: "x", type: ISSUE, first: 1) { nodes {
+  ... on Issue { number author { login } }
+  ... on PullRequest { number author { login } }
+} } }`,
+			want: []string{"Number int `json:\"number\"` Author struct { Login string `json:\"login\"` } `json:\"author\"` }"},
+		},
+		{
+			query: `query Q { search(query: "x", type: ISSUE, first: 1) { nodes {
+  ... on Issue { x: number }
+  ... on PullRequest { x: title }
+} } }`,
+			err: true,
+		},
+	}
+	for i, tt := range tests {
+		path := filepath.Join(t.TempDir(), "q.graphql")
+		if err := os.WriteFile(path, []byte(tt.query), 0644); err != nil {
+			t.Fatal(err)
+		}
+		src, err := generate("../../graphql/schema.graphql", []string{path}, "gql")
+		if tt.err {
+			if err == nil {
+				t.Errorf("query %d: conflicting fields accepted", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("query %d: %s", i, err)
+		}
+		code := strings.Join(strings.Fields(string(src)), " ")
+		for _, want := range tt.want {
+			if !strings.Contains(code, want) {
+				t.Errorf("query %d: generated code lacks %s:\n%s", i, want, src)
+			}
+		}
+	}
+}
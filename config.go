@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/idletekz/go-graphql/clone"
+	"github.com/idletekz/go-graphql/discovery"
+	"gopkg.in/yaml.v2"
+)
+
+// Config is read from the YAML file given by the -config flag.
+//
+//	apiUrl: https://github.example.com/api/v3
+//	branches:
+//	  exclude: ["dependabot/*", "renovate/*"]
+//	topics:
+//	  go:
+//	    branches:
+//	      include: ["master", "release/*", "/^v[0-9]+$/"]
+//	clone:
+//	  filter: blob:none
+//	  sparse: ["deploy", "config"]
+//	run:
+//	  - name: test
+//	    command: ["go", "test", "./..."]
+//	    timeout: 5m
+//	auth:
+//	  app:
+//	    id: 12345
+//	    privateKeyFile: /etc/props/app.pem
+//	http:
+//	  proxy: http://proxy.example.com:3128
+//	  caFile: /etc/ssl/certs/corporate.pem
+//	notify:
+//	  smtp:
+//	    addr: smtp.example.com:587
+//	    from: props@example.com
+//	  teams:
+//	    platform:
+//	      email: ["platform@example.com"]
+type Config struct {
+	// APIURL is the REST API of GitHub Enterprise Server, see setAPIURL.
+	APIURL   string                 `yaml:"apiUrl"`
+	Branches Patterns               `yaml:"branches"`
+	Topics   map[string]TopicConfig `yaml:"topics"`
+	Clone    clone.Config           `yaml:"clone"`
+	Run      []Command              `yaml:"run"`
+	Notify   NotifyConfig           `yaml:"notify"`
+	Auth     AuthConfig             `yaml:"auth"`
+	HTTP     HTTPConfig             `yaml:"http"`
+}
+
+// TopicConfig holds the settings that apply to a single topic.
+type TopicConfig struct {
+	Branches Patterns `yaml:"branches"`
+}
+
+// Patterns are branch name patterns, see discovery.NewBranchFilter.
+type Patterns struct {
+	Include []string `yaml:"include"`
+	Exclude []string `yaml:"exclude"`
+}
+
+func loadConfig(path string) (*Config, error) {
+	c := &Config{}
+	if path == "" {
+		return c, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("loadConfig: %s", err)
+	}
+	if err := yaml.UnmarshalStrict(data, c); err != nil {
+		return nil, fmt.Errorf("loadConfig %s: %s", path, err)
+	}
+	return c, nil
+}
+
+// branchFilter compiles the patterns for topic. Topic include patterns
+// replace the global ones, exclude patterns are added to the global ones.
+func (c *Config) branchFilter(topic string) (*discovery.BranchFilter, error) {
+	include := c.Branches.Include
+	exclude := c.Branches.Exclude
+	if t, ok := c.Topics[topic]; ok {
+		if len(t.Branches.Include) > 0 {
+			include = t.Branches.Include
+		}
+		exclude = append(exclude[:len(exclude):len(exclude)], t.Branches.Exclude...)
+	}
+	return discovery.NewBranchFilter(include, exclude)
+}
+
+// newRepoFilter builds a repository filter from the comma separated
+// affiliations and visibility flag values.
+func newRepoFilter(forks bool, affiliations, visibility string, archived, locked bool) (*discovery.RepoFilter, error) {
+	f := &discovery.RepoFilter{
+		Forks:        forks,
+		Affiliations: splitList(affiliations),
+		Visibility:   splitList(visibility),
+		Archived:     archived,
+		Locked:       locked,
+	}
+	if err := f.Validate(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// splitList splits a comma separated flag value into upper case items.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, strings.ToUpper(item))
+		}
+	}
+	return items
+}
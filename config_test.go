@@ -0,0 +1,56 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBranchFilterTopics(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	data := `
+branches:
+  include: [main, release/*]
+  exclude: [release/old-*]
+topics:
+  go:
+    branches:
+      include: [main, dev]
+  web:
+    branches:
+      exclude: [release/beta-*]
+`
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c, err := loadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		topic, branch string
+		want          bool
+	}{
+		{"other", "main", true},
+		{"other", "release/1.0", true},
+		{"other", "release/old-1", false},
+		{"other", "dev", false},
+		{"go", "dev", true},
+		{"go", "release/1.0", false},
+		{"web", "release/1.0", true},
+		{"web", "release/beta-1", false},
+		{"web", "release/old-1", false},
+	}
+	for _, tt := range tests {
+		f, err := c.branchFilter(tt.topic)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := f.Match(tt.branch); got != tt.want {
+			t.Errorf("topic %s: Match(%q) = %v, want %v", tt.topic, tt.branch, got, tt.want)
+		}
+	}
+	if _, err := (&Config{Branches: Patterns{Include: []string{"/[/"}}}).branchFilter("go"); err == nil {
+		t.Errorf("branchFilter accepted an invalid regular expression")
+	}
+}
@@ -0,0 +1,258 @@
+// Package discovery finds the active refs of the repositories of the GitHub
+// viewer, or of a GitHub App installation: branches with recent commits and
+// recent tags and releases of the repositories with a given topic.
+//
+// The package does not authenticate: the *graphql.Client given to it must
+// be made with an HTTP client whose transport adds the Authorization
+// header, e.g. graphql.WithHTTPClient(&http.Client{Transport: t}), and the
+// viewer is whoever that token belongs to.
+package discovery
+
+import (
+	"context"
+	"iter"
+	"path/filepath"
+	"time"
+
+	"github.com/idletekz/go-graphql/gql"
+	"github.com/machinebox/graphql"
+)
+
+// RefKind identifies what kind of ref an active Repo was found on.
+type RefKind string
+
+// Ref kinds reported by Active.
+const (
+	KindBranch  RefKind = "branch"
+	KindTag     RefKind = "tag"
+	KindRelease RefKind = "release"
+)
+
+// Repo is an active ref of a repository.
+type Repo struct {
+	ID     string // repository node ID
+	Name   string
+	URL    string
+	SSHURL string
+	Branch string // branch or tag name
+	SHA    string // commit the branch or tag points at
+	Kind   RefKind
+	Owner  string
+	Size   int64 // repository disk usage in bytes, as reported by GitHub
+	// Private is set for private and internal repositories, which not
+	// every account can access.
+	Private bool
+}
+
+// Rev returns the commit r was found on, or its branch when unknown.
+func (r *Repo) Rev() string {
+	if r.SHA != "" {
+		return r.SHA
+	}
+	return r.Branch
+}
+
+// CloneDir returns the directory of the working tree of r, relative to a
+// clone root: owner/heads/branch/name for branches and owner/tags/tag/name
+// for tags and releases, as a branch and a tag may share a name.
+func (r *Repo) CloneDir() string {
+	refs := "heads"
+	if r.Kind == KindTag || r.Kind == KindRelease {
+		refs = "tags"
+	}
+	return filepath.Join(r.Owner, refs, r.Branch, r.Name)
+}
+
+// Attrs returns the log attributes identifying r.
+func (r *Repo) Attrs() []any {
+	sha := r.SHA
+	if len(sha) > 7 {
+		sha = sha[:7]
+	}
+	return []any{"owner", r.Owner, "repo", r.Name, "ref", r.Branch, "kind", r.Kind, "sha", sha}
+}
+
+// Options select the active refs.
+type Options struct {
+	// Topic is the repository topic to look for.
+	Topic string
+	// Repos and Branches filter repositories and branch names; nil
+	// filters keep all but forks and disabled, archived or locked
+	// repositories, and all branches.
+	Repos    *RepoFilter
+	Branches *BranchFilter
+	// Since is the time after which a ref is active, a day ago when zero.
+	Since time.Time
+	// Installation, when set, lists the repositories of a GitHub App
+	// installation instead of those of the viewer, which installation
+	// tokens lack. Affiliations do not apply to them.
+	Installation *Installation
+	// OnPage, when set, is called with every page of repositories and the
+	// rate limit after it, from the goroutine fetching them.
+	OnPage func(repos []*gql.Repository, rl *gql.RateLimit)
+}
+
+// Active returns the active refs of the repositories of the viewer of
+// client, paging through them. The transport of client must authenticate
+// its requests; see the package documentation.
+func Active(ctx context.Context, client *graphql.Client, opts Options) ([]*Repo, error) {
+	var repos []*Repo
+	for r, err := range Stream(ctx, client, opts) {
+		if err != nil {
+			return nil, err
+		}
+		repos = append(repos, r)
+	}
+	return repos, nil
+}
+
+// Stream yields the active refs of the repositories of the viewer of
+// client as soon as their page is decoded; see Pages.
+func Stream(ctx context.Context, client *graphql.Client, opts Options) iter.Seq2[*Repo, error] {
+	return func(yield func(*Repo, error) bool) {
+		for repos, err := range Pages(ctx, client, opts) {
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			for _, r := range repos {
+				if !yield(r, nil) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// Pages yields the active refs of every page of repositories of the
+// viewer of client, possibly none, as soon as it is decoded. The next page
+// is fetched while the current one is consumed, and no further: a slow
+// consumer holds discovery back. A failed page ends the sequence with its
+// error; stopping the iteration stops discovery. As for Active, client
+// must authenticate its requests.
+func Pages(ctx context.Context, client *graphql.Client, opts Options) iter.Seq2[[]*Repo, error] {
+	if opts.Repos == nil {
+		opts.Repos = &RepoFilter{}
+	}
+	if opts.Since.IsZero() {
+		opts.Since = time.Now().AddDate(0, 0, -1)
+	}
+	return func(yield func([]*Repo, error) bool) {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		pages := make(chan page)
+		go fetchPages(ctx, client, &opts, pages)
+		for p := range pages {
+			if p.err != nil {
+				yield(nil, p.err)
+				return
+			}
+			if !yield(p.repos, nil) {
+				return
+			}
+		}
+	}
+}
+
+// page holds the active refs of a page of repositories, or the error
+// fetching it.
+type page struct {
+	repos []*Repo
+	err   error
+}
+
+// pager returns the next page of repositories, the rate limit after it
+// and whether more pages follow.
+type pager func(ctx context.Context) (repos []*gql.Repository, rl *gql.RateLimit, more bool, err error)
+
+// fetchPages sends the pages of repositories to pages, then closes it. It
+// gives up when ctx is done.
+func fetchPages(ctx context.Context, client *graphql.Client, opts *Options, pages chan<- page) {
+	defer close(pages)
+	next := viewerPages(client, opts.Repos.vars())
+	if opts.Installation != nil {
+		next = opts.Installation.pages(client)
+	}
+	for {
+		repos, rl, more, err := next(ctx)
+		p := page{err: err}
+		if err == nil {
+			if opts.OnPage != nil {
+				opts.OnPage(repos, rl)
+			}
+			p.repos = activeTopic(repos, opts)
+		}
+		select {
+		case pages <- p:
+		case <-ctx.Done():
+			return
+		}
+		if err != nil || !more {
+			return
+		}
+	}
+}
+
+// viewerPages pages through the repositories of the viewer.
+func viewerPages(client *graphql.Client, vars *gql.DiscoveryVariables) pager {
+	return func(ctx context.Context) ([]*gql.Repository, *gql.RateLimit, bool, error) {
+		req := graphql.NewRequest(gql.DiscoveryQuery)
+		vars.Set(req)
+		var respData gql.DiscoveryResponse
+		if err := client.Run(ctx, req, &respData); err != nil {
+			return nil, nil, false, err
+		}
+		info := respData.Viewer.Repositories.PageInfo
+		vars.After = &info.EndCursor
+		return respData.Viewer.Repositories.Nodes, &respData.RateLimit, info.HasNextPage, nil
+	}
+}
+
+// activeTopic collect active branches, tags and releases of repositories
+// with the topic of opts. Repositories and branches not matching its
+// filters are skipped.
+func activeTopic(repositories []*gql.Repository, opts *Options) (active []*Repo) {
+	for _, repo := range repositories {
+		if repo == nil || !opts.Repos.match(repo) {
+			continue
+		}
+		for _, node := range repo.RepositoryTopics.Nodes {
+			if node.Topic.Name == opts.Topic {
+				for _, branch := range repo.Refs.Nodes {
+					if branch.Target.CommittedDate.After(opts.Since) && opts.Branches.Match(branch.Name) {
+						active = append(active, newRepo(repo, branch.Name, branch.Target.OID, KindBranch))
+					}
+				}
+				released := make(map[string]bool)
+				for _, release := range repo.Releases.Nodes {
+					if !release.IsDraft && release.PublishedAt.After(opts.Since) {
+						released[release.TagName] = true
+						active = append(active, newRepo(repo, release.TagName, release.TagCommit.OID, KindRelease))
+					}
+				}
+				for _, tag := range repo.Tags.Nodes {
+					if !released[tag.Name] && tag.Date().After(opts.Since) {
+						active = append(active, newRepo(repo, tag.Name, tag.Commit(), KindTag))
+					}
+				}
+				break
+			}
+		}
+	}
+	return active
+}
+
+func newRepo(repo *gql.Repository, ref, sha string, kind RefKind) *Repo {
+	return &Repo{
+		ID:      repo.ID,
+		Name:    repo.Name,
+		Branch:  ref,
+		SHA:     sha,
+		Kind:    kind,
+		SSHURL:  repo.SSHURL,
+		URL:     repo.URL,
+		Owner:   repo.Owner.Login,
+		Size:    int64(repo.DiskUsage) * 1024,
+		Private: repo.Visibility != gql.RepositoryVisibilityPublic,
+	}
+}
@@ -0,0 +1,173 @@
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/idletekz/go-graphql/gql"
+	"github.com/machinebox/graphql"
+)
+
+// fakeViewer serves endless pages of viewer repositories, each one with the
+// repository rN, active on main, and the repository idleN, or an error for
+// page failAt. It counts the pages requested.
+func fakeViewer(t *testing.T, failAt int32, requested *atomic.Int32) *httptest.Server {
+	now := time.Now().UTC().Format(time.RFC3339)
+	old := time.Now().AddDate(0, -1, 0).UTC().Format(time.RFC3339)
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := requested.Add(1)
+		if n == failAt {
+			fmt.Fprint(w, `{"errors": [{"message": "boom"}]}`)
+			return
+		}
+		repo := `{"name": %q, "owner": {"login": "o"}, "repositoryTopics": {"nodes": [{"topic": {"name": "go"}}]},
+"refs": {"nodes": [{"name": "main", "target": {"oid": "abc", "committedDate": %q}}]}}`
+		fmt.Fprintf(w, `{"data": {"viewer": {"repositories": {"pageInfo": {"hasNextPage": true, "endCursor": "c%d"}, "nodes": [%s, %s]}}}}`,
+			n, fmt.Sprintf(repo, fmt.Sprintf("r%d", n), now), fmt.Sprintf(repo, fmt.Sprintf("idle%d", n), old))
+	}))
+}
+
+func TestPages(t *testing.T) {
+	var requested atomic.Int32
+	srv := fakeViewer(t, 3, &requested)
+	defer srv.Close()
+	var got []string
+	var err error
+	for repos, perr := range Pages(context.Background(), graphql.NewClient(srv.URL), Options{Topic: "go"}) {
+		if perr != nil {
+			err = perr
+			break
+		}
+		var names []string
+		for _, r := range repos {
+			names = append(names, r.Name)
+		}
+		got = append(got, strings.Join(names, ","))
+	}
+	if want := "r1 r2"; strings.Join(got, " ") != want {
+		t.Errorf("pages = %q, want %s", got, want)
+	}
+	if err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Errorf("err = %v, want the error of page 3", err)
+	}
+}
+
+func TestStreamStops(t *testing.T) {
+	var requested atomic.Int32
+	srv := fakeViewer(t, 0, &requested)
+	defer srv.Close()
+	for r, err := range Stream(context.Background(), graphql.NewClient(srv.URL), Options{Topic: "go"}) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.Name != "r1" {
+			t.Errorf("first ref on %s, want r1", r.Name)
+		}
+		// Page 2 may be fetched while page 1 is consumed, page 3 must
+		// not.
+		time.Sleep(100 * time.Millisecond)
+		if n := requested.Load(); n > 2 {
+			t.Errorf("%d pages requested while consuming the first one", n)
+		}
+		break
+	}
+	time.Sleep(100 * time.Millisecond)
+	if n := requested.Load(); n > 2 {
+		t.Errorf("%d pages requested after stopping", n)
+	}
+}
+
+func TestActiveTopicTags(t *testing.T) {
+	const old, recent = "2025-06-01T00:00:00Z", "2026-01-02T00:00:00Z"
+	tests := []struct {
+		name     string
+		tags     string // JSON tag nodes
+		releases string // JSON release nodes
+		want     string
+	}{
+		{
+			name: "lightweight tag",
+			tags: `{"name": "v1", "target": {"oid": "c1", "committedDate": "` + recent + `"}}`,
+			want: "tag:v1@c1",
+		},
+		{
+			name: "annotated tag dated by its tagger",
+			tags: `{"name": "v1", "target": {"oid": "t1", "tagger": {"date": "` + recent + `"}, "target": {"oid": "c1", "committedDate": "` + old + `"}}}`,
+			want: "tag:v1@c1",
+		},
+		{
+			name: "tagger date before the commit date",
+			tags: `{"name": "v1", "target": {"oid": "t1", "tagger": {"date": "` + old + `"}, "target": {"oid": "c1", "committedDate": "` + recent + `"}}}`,
+		},
+		{
+			name: "annotated tag without tagger date",
+			tags: `{"name": "v1", "target": {"oid": "t1", "target": {"oid": "c1", "committedDate": "` + recent + `"}}}`,
+			want: "tag:v1@c1",
+		},
+		{
+			name: "old tag",
+			tags: `{"name": "v1", "target": {"oid": "c1", "committedDate": "` + old + `"}}`,
+		},
+		{
+			name:     "release and its tag",
+			tags:     `{"name": "v2", "target": {"oid": "c2", "committedDate": "` + recent + `"}}`,
+			releases: `{"tagName": "v2", "publishedAt": "` + recent + `", "tagCommit": {"oid": "c2"}}`,
+			want:     "release:v2@c2",
+		},
+		{
+			name:     "draft release",
+			releases: `{"tagName": "v3", "isDraft": true, "publishedAt": "` + recent + `", "tagCommit": {"oid": "c3"}}`,
+		},
+		{
+			name:     "tag of a draft release",
+			tags:     `{"name": "v3", "target": {"oid": "c3", "committedDate": "` + recent + `"}}`,
+			releases: `{"tagName": "v3", "isDraft": true, "publishedAt": "` + recent + `", "tagCommit": {"oid": "c3"}}`,
+			want:     "tag:v3@c3",
+		},
+		{
+			name:     "tag of an old release",
+			tags:     `{"name": "v4", "target": {"oid": "c4", "committedDate": "` + recent + `"}}`,
+			releases: `{"tagName": "v4", "publishedAt": "` + old + `", "tagCommit": {"oid": "c4"}}`,
+			want:     "tag:v4@c4",
+		},
+	}
+	since, err := time.Parse(time.RFC3339, "2026-01-01T00:00:00Z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		var repo gql.Repository
+		data := `{"name": "r", "owner": {"login": "o"}, "repositoryTopics": {"nodes": [{"topic": {"name": "go"}}]},
+"tags": {"nodes": [` + tt.tags + `]}, "releases": {"nodes": [` + tt.releases + `]}}`
+		if err := json.Unmarshal([]byte(data), &repo); err != nil {
+			t.Fatalf("%s: %s", tt.name, err)
+		}
+		var got []string
+		for _, r := range activeTopic([]*gql.Repository{&repo}, &Options{Topic: "go", Repos: &RepoFilter{}, Since: since}) {
+			got = append(got, fmt.Sprintf("%s:%s@%s", r.Kind, r.Branch, r.SHA))
+		}
+		if strings.Join(got, " ") != tt.want {
+			t.Errorf("%s: active refs %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCloneDir(t *testing.T) {
+	branch := &Repo{Owner: "o", Name: "r", Branch: "v1", Kind: KindBranch}
+	tag := &Repo{Owner: "o", Name: "r", Branch: "v1", Kind: KindTag}
+	release := &Repo{Owner: "o", Name: "r", Branch: "v1", Kind: KindRelease}
+	slashed := &Repo{Owner: "o", Name: "r", Branch: "tags/v1", Kind: KindBranch}
+	if branch.CloneDir() == tag.CloneDir() || slashed.CloneDir() == tag.CloneDir() {
+		t.Errorf("a branch and a tag share %s", tag.CloneDir())
+	}
+	if tag.CloneDir() != release.CloneDir() {
+		t.Errorf("a release is cloned in %s, its tag in %s", release.CloneDir(), tag.CloneDir())
+	}
+}
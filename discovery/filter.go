@@ -0,0 +1,154 @@
+package discovery
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/idletekz/go-graphql/gql"
+)
+
+// RepoFilter selects the repositories considered for discovery.
+type RepoFilter struct {
+	Forks        bool     // include forks
+	Affiliations []string // OWNER, COLLABORATOR, ORGANIZATION_MEMBER
+	Visibility   []string // PUBLIC, PRIVATE, INTERNAL; empty means any
+	Archived     bool     // include archived repositories
+	Locked       bool     // include locked repositories
+}
+
+var (
+	validAffiliations = []string{"OWNER", "COLLABORATOR", "ORGANIZATION_MEMBER"}
+	validVisibility   = []string{"PUBLIC", "PRIVATE", "INTERNAL"}
+)
+
+// Validate checks the affiliations and visibilities of f.
+func (f *RepoFilter) Validate() error {
+	for _, a := range f.Affiliations {
+		if !contains(validAffiliations, a) {
+			return fmt.Errorf("unknown affiliation %q, want one of %s", a, strings.Join(validAffiliations, ", "))
+		}
+	}
+	for _, v := range f.Visibility {
+		if !contains(validVisibility, v) {
+			return fmt.Errorf("unknown visibility %q, want one of %s", v, strings.Join(validVisibility, ", "))
+		}
+	}
+	return nil
+}
+
+// vars returns the query variables for the filters GitHub applies server
+// side.
+func (f *RepoFilter) vars() *gql.DiscoveryVariables {
+	vars := &gql.DiscoveryVariables{}
+	if !f.Forks {
+		isFork := false
+		vars.IsFork = &isFork
+	}
+	for _, a := range f.Affiliations {
+		vars.Affiliations = append(vars.Affiliations, gql.RepositoryAffiliation(a))
+	}
+	return vars
+}
+
+// match applies the filters GitHub can't apply server side, and forks for
+// installations. Disabled repositories are always skipped.
+func (f *RepoFilter) match(repo *gql.Repository) bool {
+	switch {
+	case repo.IsDisabled:
+		return false
+	case repo.IsFork && !f.Forks:
+		return false
+	case repo.IsArchived && !f.Archived:
+		return false
+	case repo.IsLocked && !f.Locked:
+		return false
+	case len(f.Visibility) > 0 && !contains(f.Visibility, string(repo.Visibility)):
+		return false
+	}
+	return true
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// BranchFilter decides which branch names produce a Repo.
+type BranchFilter struct {
+	include []*regexp.Regexp
+	exclude []*regexp.Regexp
+}
+
+// NewBranchFilter compiles the include and exclude patterns. A pattern
+// enclosed in slashes is a regular expression, anything else is a glob
+// where * matches any run of characters (including /) and ? matches a
+// single character.
+func NewBranchFilter(include, exclude []string) (*BranchFilter, error) {
+	f := &BranchFilter{}
+	var err error
+	if f.include, err = compilePatterns(include); err != nil {
+		return nil, err
+	}
+	if f.exclude, err = compilePatterns(exclude); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Match reports whether name matches an include pattern (or no include
+// pattern is set) and no exclude pattern.
+func (f *BranchFilter) Match(name string) bool {
+	if f == nil {
+		return true
+	}
+	if len(f.include) > 0 && !matchAny(f.include, name) {
+		return false
+	}
+	return !matchAny(f.exclude, name)
+}
+
+func matchAny(res []*regexp.Regexp, name string) bool {
+	for _, re := range res {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+func compilePatterns(patterns []string) ([]*regexp.Regexp, error) {
+	var res []*regexp.Regexp
+	for _, p := range patterns {
+		re, err := compilePattern(p)
+		if err != nil {
+			return nil, fmt.Errorf("pattern %q: %s", p, err)
+		}
+		res = append(res, re)
+	}
+	return res, nil
+}
+
+func compilePattern(p string) (*regexp.Regexp, error) {
+	if len(p) > 1 && strings.HasPrefix(p, "/") && strings.HasSuffix(p, "/") {
+		return regexp.Compile(p[1 : len(p)-1])
+	}
+	var b strings.Builder
+	b.WriteString("^")
+	for _, c := range p {
+		switch c {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
@@ -0,0 +1,99 @@
+package discovery
+
+import (
+	"testing"
+
+	"github.com/idletekz/go-graphql/gql"
+)
+
+func TestCompilePattern(t *testing.T) {
+	tests := []struct {
+		pattern, name string
+		want          bool
+	}{
+		{"main", "main", true},
+		{"main", "main2", false},
+		{"main", "xmain", false},
+		{"release/*", "release/1.0", true},
+		{"release/*", "release/1.0/hotfix", true},
+		{"release/*", "release", false},
+		{"*", "feature/x", true},
+		{"v?", "v1", true},
+		{"v?", "v10", false},
+		{"v1.0", "v1x0", false},
+		{"feat+x", "feat+x", true},
+		{"/^dep-[0-9]+$/", "dep-12", true},
+		{"/^dep-[0-9]+$/", "dep-x", false},
+		{"/dep/", "my-dep-branch", true},
+		{"/", "/", true},
+	}
+	for _, tt := range tests {
+		re, err := compilePattern(tt.pattern)
+		if err != nil {
+			t.Errorf("compilePattern(%q): %s", tt.pattern, err)
+			continue
+		}
+		if got := re.MatchString(tt.name); got != tt.want {
+			t.Errorf("pattern %q matches %q = %v, want %v", tt.pattern, tt.name, got, tt.want)
+		}
+	}
+	if _, err := compilePattern("/[/"); err == nil {
+		t.Errorf("compilePattern accepted an invalid regular expression")
+	}
+}
+
+func TestBranchFilter(t *testing.T) {
+	f, err := NewBranchFilter([]string{"main", "release/*"}, []string{"release/old-*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"main", true},
+		{"release/2.0", true},
+		{"release/old-1.0", false},
+		{"feature/x", false},
+	}
+	for _, tt := range tests {
+		if got := f.Match(tt.name); got != tt.want {
+			t.Errorf("Match(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+	var all *BranchFilter
+	if !all.Match("anything") {
+		t.Errorf("nil filter rejected a branch")
+	}
+}
+
+func TestRepoFilter(t *testing.T) {
+	tests := []struct {
+		filter RepoFilter
+		repo   gql.Repository
+		want   bool
+	}{
+		{RepoFilter{}, gql.Repository{}, true},
+		{RepoFilter{}, gql.Repository{IsDisabled: true}, false},
+		{RepoFilter{Archived: true, Locked: true, Forks: true}, gql.Repository{IsDisabled: true}, false},
+		{RepoFilter{}, gql.Repository{IsArchived: true}, false},
+		{RepoFilter{Archived: true}, gql.Repository{IsArchived: true}, true},
+		{RepoFilter{}, gql.Repository{IsLocked: true}, false},
+		{RepoFilter{Locked: true}, gql.Repository{IsLocked: true}, true},
+		{RepoFilter{}, gql.Repository{IsFork: true}, false},
+		{RepoFilter{Forks: true}, gql.Repository{IsFork: true}, true},
+		{RepoFilter{Visibility: []string{"PRIVATE"}}, gql.Repository{Visibility: "PUBLIC"}, false},
+		{RepoFilter{Visibility: []string{"PRIVATE", "PUBLIC"}}, gql.Repository{Visibility: "PUBLIC"}, true},
+	}
+	for _, tt := range tests {
+		if got := tt.filter.match(&tt.repo); got != tt.want {
+			t.Errorf("%+v match %+v = %v, want %v", tt.filter, tt.repo, got, tt.want)
+		}
+	}
+	if err := (&RepoFilter{Affiliations: []string{"OWNER", "MEMBER"}}).Validate(); err == nil {
+		t.Errorf("Validate accepted the affiliation MEMBER")
+	}
+	if err := (&RepoFilter{Visibility: []string{"SECRET"}}).Validate(); err == nil {
+		t.Errorf("Validate accepted the visibility SECRET")
+	}
+}
@@ -0,0 +1,89 @@
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/idletekz/go-graphql/gql"
+	"github.com/machinebox/graphql"
+)
+
+// Installation lists the repositories a GitHub App installation can
+// access, through the REST API.
+type Installation struct {
+	// Client must authenticate its requests with an installation token.
+	Client *http.Client
+	// APIURL is the REST API, https://api.github.com by default.
+	APIURL string
+}
+
+// installationPage is the number of repositories listed per request, the
+// most GitHub returns.
+const installationPage = 100
+
+// pages pages through the repositories of the installation, listing their
+// node IDs with the REST API and querying them through client.
+func (in *Installation) pages(client *graphql.Client) pager {
+	n := 0
+	return func(ctx context.Context) ([]*gql.Repository, *gql.RateLimit, bool, error) {
+		n++
+		ids, total, err := in.list(ctx, n)
+		if err != nil {
+			return nil, nil, false, err
+		}
+		more := n*installationPage < total
+		if len(ids) == 0 {
+			return nil, nil, more, nil
+		}
+		req := graphql.NewRequest(gql.InstallationDiscoveryQuery)
+		(&gql.InstallationDiscoveryVariables{Ids: ids}).Set(req)
+		var respData gql.InstallationDiscoveryResponse
+		if err := client.Run(ctx, req, &respData); err != nil {
+			return nil, nil, false, err
+		}
+		return respData.Nodes, &respData.RateLimit, more, nil
+	}
+}
+
+// list returns the node IDs of the repositories of page n, counting from
+// 1, and the number of repositories of the installation.
+func (in *Installation) list(ctx context.Context, n int) ([]string, int, error) {
+	api := in.APIURL
+	if api == "" {
+		api = "https://api.github.com"
+	}
+	url := fmt.Sprintf("%s/installation/repositories?per_page=%d&page=%d", api, installationPage, n)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	client := in.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, 0, fmt.Errorf("installation repositories: %s", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf("installation repositories status code: %v", res.StatusCode)
+	}
+	var body struct {
+		TotalCount   int `json:"total_count"`
+		Repositories []struct {
+			NodeID string `json:"node_id"`
+		} `json:"repositories"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		return nil, 0, fmt.Errorf("installation repositories: %s", err)
+	}
+	ids := make([]string, len(body.Repositories))
+	for i, r := range body.Repositories {
+		ids[i] = r.NodeID
+	}
+	return ids, body.TotalCount, nil
+}
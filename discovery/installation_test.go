@@ -0,0 +1,74 @@
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/idletekz/go-graphql/gql"
+	"github.com/machinebox/graphql"
+)
+
+// fakeInstallation serves two pages of installation repositories and
+// their GraphQL nodes: the fork f1, the inaccessible gone and the active
+// repositories r1 and r2.
+func fakeInstallation(t *testing.T) *httptest.Server {
+	now := time.Now().UTC().Format(time.RFC3339)
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/installation/repositories" {
+			ids := map[string]string{"1": `"r1", "f1", "gone"`, "2": `"r2"`}[r.URL.Query().Get("page")]
+			var repos []string
+			for _, id := range strings.Split(ids, ", ") {
+				repos = append(repos, fmt.Sprintf(`{"node_id": %s}`, id))
+			}
+			fmt.Fprintf(w, `{"total_count": 150, "repositories": [%s]}`, strings.Join(repos, ", "))
+			return
+		}
+		var body struct {
+			Variables struct{ IDs []string }
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Error(err)
+		}
+		var nodes []string
+		for _, id := range body.Variables.IDs {
+			if id == "gone" {
+				nodes = append(nodes, "null")
+				continue
+			}
+			nodes = append(nodes, fmt.Sprintf(`{"id": %q, "name": %q, "isFork": %t, "owner": {"login": "o"},
+"repositoryTopics": {"nodes": [{"topic": {"name": "go"}}]},
+"refs": {"nodes": [{"name": "main", "target": {"oid": "abc", "committedDate": %q}}]}}`, id, id, id == "f1", now))
+		}
+		fmt.Fprintf(w, `{"data": {"nodes": [%s], "rateLimit": {"cost": 1}}}`, strings.Join(nodes, ", "))
+	}))
+}
+
+func TestActiveInstallation(t *testing.T) {
+	srv := fakeInstallation(t)
+	defer srv.Close()
+	pages := 0
+	repos, err := Active(context.Background(), graphql.NewClient(srv.URL+"/graphql"), Options{
+		Topic:        "go",
+		Installation: &Installation{Client: srv.Client(), APIURL: srv.URL},
+		OnPage:       func(_ []*gql.Repository, _ *gql.RateLimit) { pages++ },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, r := range repos {
+		got = append(got, r.Name+"@"+r.Branch)
+	}
+	if want := "r1@main r2@main"; strings.Join(got, " ") != want {
+		t.Errorf("active refs = %s, want %s", got, want)
+	}
+	if pages != 2 {
+		t.Errorf("%d pages, want 2", pages)
+	}
+}
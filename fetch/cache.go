@@ -0,0 +1,83 @@
+package fetch
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/idletekz/go-graphql/discovery"
+)
+
+// Cache stores, in Dir, the files fetched from commits. The content of a
+// path at a commit never changes, so entries never expire, and a path
+// missing at a commit is cached too. Entries are only readable by the
+// user: they may hold private repository content.
+type Cache struct {
+	Dir string
+}
+
+type cacheEntry struct {
+	Key  string `json:"key"`
+	Blob *Blob  `json:"blob"` // nil when the path does not exist
+}
+
+// cacheKey returns the key of path at the commit of r, or "" when r has no
+// commit and its file may change.
+func cacheKey(r *discovery.Repo, path string) string {
+	if r.SHA == "" {
+		return ""
+	}
+	return r.Owner + "/" + r.Name + "@" + r.SHA + ":" + path
+}
+
+func (c *Cache) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(c.Dir, hex.EncodeToString(sum[:])+".json")
+}
+
+// get returns the entry of key, or nil when it is not cached. c may be
+// nil, disabling the cache.
+func (c *Cache) get(key string) *cacheEntry {
+	if c == nil || key == "" {
+		return nil
+	}
+	data, err := ioutil.ReadFile(c.path(key))
+	if err != nil {
+		return nil
+	}
+	var e cacheEntry
+	if err := json.Unmarshal(data, &e); err != nil || e.Key != key {
+		return nil
+	}
+	return &e
+}
+
+func (c *Cache) put(e *cacheEntry) error {
+	if c == nil || e.Key == "" {
+		return nil
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(c.Dir, 0700); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(c.Dir, "entry")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), c.path(e.Key))
+}
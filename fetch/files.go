@@ -0,0 +1,153 @@
+// Package fetch reads files of the refs found by discovery, in batches
+// through the GraphQL API. Like discovery, it leaves authentication to the
+// transport of the *graphql.Client it is given, which needs read access to
+// the contents of every repository fetched from.
+package fetch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/idletekz/go-graphql/discovery"
+	"github.com/idletekz/go-graphql/gql"
+	"github.com/machinebox/graphql"
+)
+
+// BatchSize is the number of repository/branch pairs requested per query.
+const BatchSize = 50
+
+// Blob is a file fetched by Files.
+type Blob = gql.Blob
+
+// blobQuery builds a query fetching n files, aliased b0..bn-1, each one
+// parameterized by the $oN (owner), $nN (name) and $eN (expression) variables.
+func blobQuery(n int) string {
+	var vars []string
+	var fields strings.Builder
+	for i := 0; i < n; i++ {
+		vars = append(vars, fmt.Sprintf("$o%d: String!, $n%d: String!, $e%d: String!", i, i, i))
+		fmt.Fprintf(&fields, `
+  b%d: repository(owner: $o%d, name: $n%d) {
+    object(expression: $e%d) {
+      ...Blob
+    }
+  }`, i, i, i, i)
+	}
+	fields.WriteString(`
+  rateLimit {
+    ...RateLimit
+  }`)
+	return fmt.Sprintf("query(%s) {%s\n}\n%s%s", strings.Join(vars, ", "), fields.String(), gql.BlobFragment, gql.RateLimitFragment)
+}
+
+// Fetcher fetches files through the GraphQL API.
+type Fetcher struct {
+	// Client must authenticate its requests, through the transport of its
+	// HTTP client.
+	Client *graphql.Client
+	// Observe, when set, is called with the duration, the rate limit
+	// after it and the outcome of every batch request.
+	Observe func(d time.Duration, rl *gql.RateLimit, err error)
+	// Cache, when set, serves the files of the refs already fetched at
+	// the same commit; only the others are requested.
+	Cache *Cache
+}
+
+// Files fetches path from the ref of every repo through client; see
+// Fetcher.Files.
+func Files(ctx context.Context, client *graphql.Client, repos []*discovery.Repo, path string) (map[*discovery.Repo]*Blob, error) {
+	return (&Fetcher{Client: client}).Files(ctx, repos, path)
+}
+
+// Files fetches path from the ref of every repo, batching up to BatchSize
+// repositories per request. Repositories where path does not exist are
+// absent from the result.
+func (f *Fetcher) Files(ctx context.Context, repos []*discovery.Repo, path string) (map[*discovery.Repo]*Blob, error) {
+	found := make(map[*discovery.Repo]*Blob)
+	var missing []*discovery.Repo
+	for _, r := range repos {
+		e := f.Cache.get(cacheKey(r, path))
+		if e == nil {
+			missing = append(missing, r)
+		} else if e.Blob != nil {
+			found[r] = e.Blob
+		}
+	}
+	repos = missing
+	for start := 0; start < len(repos); start += BatchSize {
+		end := start + BatchSize
+		if end > len(repos) {
+			end = len(repos)
+		}
+		batch := repos[start:end]
+		if err := f.batch(ctx, batch, path, found); err != nil {
+			return nil, fmt.Errorf("fetch.Files: %s", err)
+		}
+	}
+	return found, nil
+}
+
+// batch fetches path from the refs of batch into found, with one request,
+// and caches the outcome of the readable repositories.
+func (f *Fetcher) batch(ctx context.Context, batch []*discovery.Repo, path string, found map[*discovery.Repo]*Blob) (err error) {
+	var respData map[string]json.RawMessage
+	var rl *gql.RateLimit
+	if f.Observe != nil {
+		start := time.Now()
+		defer func() { f.Observe(time.Since(start), rl, err) }()
+	}
+	req := graphql.NewRequest(blobQuery(len(batch)))
+	for i, r := range batch {
+		req.Var(fmt.Sprintf("o%d", i), r.Owner)
+		req.Var(fmt.Sprintf("n%d", i), r.Name)
+		req.Var(fmt.Sprintf("e%d", i), r.Rev()+":"+path)
+	}
+	if err := f.Client.Run(ctx, req, &respData); err != nil {
+		return err
+	}
+	if data, ok := respData["rateLimit"]; ok {
+		rl = &gql.RateLimit{}
+		if err := json.Unmarshal(data, rl); err != nil {
+			return err
+		}
+	}
+	for i, r := range batch {
+		data, ok := respData[fmt.Sprintf("b%d", i)]
+		if !ok {
+			continue
+		}
+		var node *struct {
+			Object *Blob
+		}
+		if err := json.Unmarshal(data, &node); err != nil {
+			return err
+		}
+		if node == nil {
+			// The repository cannot be read, maybe for now only.
+			continue
+		}
+		if err := f.Cache.put(&cacheEntry{Key: cacheKey(r, path), Blob: node.Object}); err != nil {
+			slog.Warn("fetch cache: entry not stored", "owner", r.Owner, "repo", r.Name, "err", err)
+		}
+		if node.Object != nil {
+			found[r] = node.Object
+		}
+	}
+	return nil
+}
+
+// Text returns the text of the file path fetched for r by Files.
+func Text(found map[*discovery.Repo]*Blob, r *discovery.Repo, path string) (string, error) {
+	b, ok := found[r]
+	if !ok {
+		return "", fmt.Errorf("%s not found on %s/%s@%s", path, r.Owner, r.Name, r.Branch)
+	}
+	if b.IsBinary {
+		return "", fmt.Errorf("%s is binary on %s/%s@%s", path, r.Owner, r.Name, r.Branch)
+	}
+	return b.Text, nil
+}
@@ -0,0 +1,163 @@
+package fetch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/idletekz/go-graphql/discovery"
+	"github.com/idletekz/go-graphql/gql"
+	"github.com/machinebox/graphql"
+	"github.com/vektah/gqlparser/v2"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+func TestBlobQuery(t *testing.T) {
+	data, err := os.ReadFile("../graphql/schema.graphql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema, err := gqlparser.LoadSchema(&ast.Source{Name: "schema.graphql", Input: string(data)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range []int{1, 3} {
+		q := blobQuery(n)
+		doc, errs := gqlparser.LoadQuery(schema, q)
+		if errs != nil {
+			t.Fatalf("blobQuery(%d): %s\n%s", n, errs, q)
+		}
+		op := doc.Operations[0]
+		if len(op.VariableDefinitions) != 3*n {
+			t.Errorf("blobQuery(%d) has %d variables, want %d", n, len(op.VariableDefinitions), 3*n)
+		}
+		if len(op.SelectionSet) != n+1 {
+			t.Errorf("blobQuery(%d) selects %d fields, want %d", n, len(op.SelectionSet), n+1)
+		}
+		if len(doc.Fragments) != 2 {
+			t.Errorf("blobQuery(%d) has %d fragments, want Blob and RateLimit", n, len(doc.Fragments))
+		}
+	}
+}
+
+func TestFiles(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Variables map[string]string
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Error(err)
+		}
+		var fields []string
+		for i := 0; body.Variables[fmt.Sprintf("n%d", i)] != ""; i++ {
+			switch name := body.Variables[fmt.Sprintf("n%d", i)]; name {
+			case "missing":
+				fields = append(fields, fmt.Sprintf(`"b%d": {"object": null}`, i))
+			case "gone":
+				fields = append(fields, fmt.Sprintf(`"b%d": null`, i))
+			default:
+				fields = append(fields, fmt.Sprintf(`"b%d": {"object": {"text": %q}}`, i, body.Variables[fmt.Sprintf("e%d", i)]))
+			}
+		}
+		fields = append(fields, `"rateLimit": {"cost": 1, "remaining": 4999}`)
+		fmt.Fprintf(w, `{"data": {%s}}`, strings.Join(fields, ", "))
+	}))
+	defer srv.Close()
+	var repos []*discovery.Repo
+	for i := 0; i < BatchSize+2; i++ {
+		repos = append(repos, &discovery.Repo{Owner: "o", Name: fmt.Sprintf("r%d", i), SHA: fmt.Sprintf("sha%d", i)})
+	}
+	repos = append(repos, &discovery.Repo{Owner: "o", Name: "missing"}, &discovery.Repo{Owner: "o", Name: "gone"})
+	var batches, cost int
+	f := &Fetcher{
+		Client: graphql.NewClient(srv.URL),
+		Observe: func(d time.Duration, rl *gql.RateLimit, err error) {
+			batches++
+			if err != nil {
+				t.Error(err)
+			}
+			if rl != nil {
+				cost += rl.Cost
+			}
+		},
+	}
+	found, err := f.Files(context.Background(), repos, "props.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != BatchSize+2 {
+		t.Errorf("found %d files, want %d", len(found), BatchSize+2)
+	}
+	if text, err := Text(found, repos[BatchSize+1], "props.yml"); err != nil || text != fmt.Sprintf("sha%d:props.yml", BatchSize+1) {
+		t.Errorf("Text = %q, %v", text, err)
+	}
+	if _, err := Text(found, repos[len(repos)-1], "props.yml"); err == nil {
+		t.Errorf("Text of a missing file succeeded")
+	}
+	if batches != 2 || cost != 2 {
+		t.Errorf("observed %d batches costing %d, want 2 and 2", batches, cost)
+	}
+}
+
+func TestFilesCache(t *testing.T) {
+	var requested []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Variables map[string]string
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Error(err)
+		}
+		var fields []string
+		for i := 0; body.Variables[fmt.Sprintf("n%d", i)] != ""; i++ {
+			name := body.Variables[fmt.Sprintf("n%d", i)]
+			requested = append(requested, name)
+			switch name {
+			case "missing":
+				fields = append(fields, fmt.Sprintf(`"b%d": {"object": null}`, i))
+			case "gone":
+				fields = append(fields, fmt.Sprintf(`"b%d": null`, i))
+			default:
+				fields = append(fields, fmt.Sprintf(`"b%d": {"object": {"text": "props of %s"}}`, i, name))
+			}
+		}
+		fmt.Fprintf(w, `{"data": {%s}}`, strings.Join(fields, ", "))
+	}))
+	defer srv.Close()
+	repos := []*discovery.Repo{
+		{Owner: "o", Name: "cached", SHA: "a"},
+		{Owner: "o", Name: "missing", SHA: "b"},
+		{Owner: "o", Name: "gone", SHA: "c"},
+		{Owner: "o", Name: "branch", Branch: "main"},
+	}
+	cache := &Cache{Dir: t.TempDir()}
+	for run, want := range []string{"cached missing gone branch", "gone branch"} {
+		requested = nil
+		f := &Fetcher{Client: graphql.NewClient(srv.URL), Cache: cache}
+		found, err := f.Files(context.Background(), repos, "props.yml")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Join(requested, " "); got != want {
+			t.Errorf("run %d requested %s, want %s", run, got, want)
+		}
+		if text, err := Text(found, repos[0], "props.yml"); err != nil || text != "props of cached" {
+			t.Errorf("run %d: Text = %q, %v", run, text, err)
+		}
+		if _, err := Text(found, repos[1], "props.yml"); err == nil {
+			t.Errorf("run %d: Text of a missing file succeeded", run)
+		}
+	}
+	if _, err := (&Fetcher{Client: graphql.NewClient(srv.URL), Cache: cache}).Files(context.Background(), repos[:1], "other.yml"); err != nil {
+		t.Fatal(err)
+	}
+	if requested[len(requested)-1] != "cached" {
+		t.Errorf("another path was served from the cache")
+	}
+}
@@ -0,0 +1,27 @@
+// Package gql holds the GitHub GraphQL operations of the graphql directory
+// and their Go types, generated by cmd/graphqlgen.
+package gql
+
+import "time"
+
+//go:generate go run ../cmd/graphqlgen -package gql -schema ../graphql/schema.graphql -out graphql_gen.go ../graphql/discovery.graphql ../graphql/blob.graphql ../graphql/report.graphql ../graphql/viewer.graphql ../graphql/issue.graphql
+
+// Date returns when the tag was created: the tagger date for annotated tags,
+// falling back to the date of the tagged commit.
+func (t *TagRef) Date() time.Time {
+	switch {
+	case !t.Target.Tagger.Date.IsZero():
+		return t.Target.Tagger.Date
+	case !t.Target.Target.CommittedDate.IsZero():
+		return t.Target.Target.CommittedDate
+	}
+	return t.Target.CommittedDate
+}
+
+// Commit returns the oid of the tagged commit.
+func (t *TagRef) Commit() string {
+	if t.Target.Target.OID != "" {
+		return t.Target.Target.OID
+	}
+	return t.Target.OID
+}
@@ -0,0 +1,687 @@
+// Code generated by graphqlgen. DO NOT EDIT.
+
+package gql
+
+import (
+	"time"
+
+	"github.com/machinebox/graphql"
+)
+
+// RateLimit is selected by fragment RateLimit on RateLimit.
+type RateLimit struct {
+	Cost      int       `json:"cost"`
+	Limit     int       `json:"limit"`
+	Remaining int       `json:"remaining"`
+	ResetAt   time.Time `json:"resetAt"`
+}
+
+// RateLimitFragment is the document of fragment RateLimit.
+const RateLimitFragment = `
+fragment RateLimit on RateLimit {
+  cost
+  limit
+  remaining
+  resetAt
+}
+`
+
+// Repository is selected by fragment Repository on Repository.
+type Repository struct {
+	Name       string               `json:"name"`
+	URL        string               `json:"url"`
+	ID         string               `json:"id"`
+	SSHURL     string               `json:"sshUrl"`
+	IsFork     bool                 `json:"isFork"`
+	IsArchived bool                 `json:"isArchived"`
+	IsDisabled bool                 `json:"isDisabled"`
+	IsLocked   bool                 `json:"isLocked"`
+	Visibility RepositoryVisibility `json:"visibility"`
+	DiskUsage  int                  `json:"diskUsage"`
+	Owner      struct {
+		Login string `json:"login"`
+	} `json:"owner"`
+	RepositoryTopics struct {
+		TotalCount int `json:"totalCount"`
+		Nodes      []*struct {
+			Topic struct {
+				Name string `json:"name"`
+			} `json:"topic"`
+		} `json:"nodes"`
+	} `json:"repositoryTopics"`
+	Refs struct {
+		TotalCount int `json:"totalCount"`
+		Nodes      []*struct {
+			Name   string `json:"name"`
+			Target struct {
+				OID           string    `json:"oid"`
+				CommittedDate time.Time `json:"committedDate"`
+			} `json:"target"`
+		} `json:"nodes"`
+	} `json:"refs"`
+	Tags struct {
+		Nodes []*TagRef `json:"nodes"`
+	} `json:"tags"`
+	Releases struct {
+		Nodes []*struct {
+			TagName     string    `json:"tagName"`
+			IsDraft     bool      `json:"isDraft"`
+			PublishedAt time.Time `json:"publishedAt"`
+			TagCommit   struct {
+				OID string `json:"oid"`
+			} `json:"tagCommit"`
+		} `json:"nodes"`
+	} `json:"releases"`
+}
+
+// RepositoryFragment is the document of fragment Repository.
+const RepositoryFragment = `
+fragment Repository on Repository {
+  name
+  url
+  id
+  sshUrl
+  isFork
+  isArchived
+  isDisabled
+  isLocked
+  visibility
+  diskUsage
+  owner {
+    login
+  }
+  repositoryTopics(first: 100) {
+    totalCount
+    nodes {
+      topic {
+        name
+      }
+    }
+  }
+  refs(first: 100, refPrefix: "refs/heads/") {
+    totalCount
+    nodes {
+      name
+      target {
+        ... on Commit {
+          oid
+          committedDate
+        }
+      }
+    }
+  }
+  tags: refs(first: 100, refPrefix: "refs/tags/", orderBy: {field:TAG_COMMIT_DATE,direction:DESC}) {
+    nodes {
+      ... TagRef
+    }
+  }
+  releases(first: 20, orderBy: {field:CREATED_AT,direction:DESC}) {
+    nodes {
+      tagName
+      isDraft
+      publishedAt
+      tagCommit {
+        oid
+      }
+    }
+  }
+}
+fragment TagRef on Ref {
+  name
+  target {
+    ... on Commit {
+      oid
+      committedDate
+    }
+    ... on Tag {
+      tagger {
+        date
+      }
+      target {
+        ... on Commit {
+          oid
+          committedDate
+        }
+      }
+    }
+  }
+}
+`
+
+// TagRef is selected by fragment TagRef on Ref.
+type TagRef struct {
+	Name   string `json:"name"`
+	Target struct {
+		OID           string    `json:"oid"`
+		CommittedDate time.Time `json:"committedDate"`
+		Tagger        struct {
+			Date time.Time `json:"date"`
+		} `json:"tagger"`
+		Target struct {
+			OID           string    `json:"oid"`
+			CommittedDate time.Time `json:"committedDate"`
+		} `json:"target"`
+	} `json:"target"`
+}
+
+// TagRefFragment is the document of fragment TagRef.
+const TagRefFragment = `
+fragment TagRef on Ref {
+  name
+  target {
+    ... on Commit {
+      oid
+      committedDate
+    }
+    ... on Tag {
+      tagger {
+        date
+      }
+      target {
+        ... on Commit {
+          oid
+          committedDate
+        }
+      }
+    }
+  }
+}
+`
+
+// Blob is selected by fragment Blob on Blob.
+type Blob struct {
+	Text     string `json:"text"`
+	ByteSize int    `json:"byteSize"`
+	IsBinary bool   `json:"isBinary"`
+}
+
+// BlobFragment is the document of fragment Blob.
+const BlobFragment = `
+fragment Blob on Blob {
+  text
+  byteSize
+  isBinary
+}
+`
+
+// DiscoveryQuery is the document of query Discovery.
+const DiscoveryQuery = `
+query Discovery ($after: String, $isFork: Boolean, $affiliations: [RepositoryAffiliation]) {
+  viewer {
+    login
+    repositories(first: 100, after: $after, isFork: $isFork, affiliations: $affiliations) {
+      totalCount
+      pageInfo {
+        endCursor
+        hasNextPage
+      }
+      nodes {
+        ... Repository
+      }
+    }
+  }
+  rateLimit {
+    ... RateLimit
+  }
+}
+fragment RateLimit on RateLimit {
+  cost
+  limit
+  remaining
+  resetAt
+}
+fragment Repository on Repository {
+  name
+  url
+  id
+  sshUrl
+  isFork
+  isArchived
+  isDisabled
+  isLocked
+  visibility
+  diskUsage
+  owner {
+    login
+  }
+  repositoryTopics(first: 100) {
+    totalCount
+    nodes {
+      topic {
+        name
+      }
+    }
+  }
+  refs(first: 100, refPrefix: "refs/heads/") {
+    totalCount
+    nodes {
+      name
+      target {
+        ... on Commit {
+          oid
+          committedDate
+        }
+      }
+    }
+  }
+  tags: refs(first: 100, refPrefix: "refs/tags/", orderBy: {field:TAG_COMMIT_DATE,direction:DESC}) {
+    nodes {
+      ... TagRef
+    }
+  }
+  releases(first: 20, orderBy: {field:CREATED_AT,direction:DESC}) {
+    nodes {
+      tagName
+      isDraft
+      publishedAt
+      tagCommit {
+        oid
+      }
+    }
+  }
+}
+fragment TagRef on Ref {
+  name
+  target {
+    ... on Commit {
+      oid
+      committedDate
+    }
+    ... on Tag {
+      tagger {
+        date
+      }
+      target {
+        ... on Commit {
+          oid
+          committedDate
+        }
+      }
+    }
+  }
+}
+`
+
+// DiscoveryResponse is the data returned by query Discovery.
+type DiscoveryResponse struct {
+	Viewer struct {
+		Login        string `json:"login"`
+		Repositories struct {
+			TotalCount int `json:"totalCount"`
+			PageInfo   struct {
+				EndCursor   string `json:"endCursor"`
+				HasNextPage bool   `json:"hasNextPage"`
+			} `json:"pageInfo"`
+			Nodes []*Repository `json:"nodes"`
+		} `json:"repositories"`
+	} `json:"viewer"`
+	RateLimit RateLimit `json:"rateLimit"`
+}
+
+// DiscoveryVariables are the variables of query Discovery.
+type DiscoveryVariables struct {
+	After        *string
+	IsFork       *bool
+	Affiliations []RepositoryAffiliation
+}
+
+// Set assigns the variables to req, leaving out unset optional ones.
+func (v *DiscoveryVariables) Set(req *graphql.Request) {
+	if v.After != nil {
+		req.Var("after", *v.After)
+	}
+	if v.IsFork != nil {
+		req.Var("isFork", *v.IsFork)
+	}
+	if v.Affiliations != nil {
+		req.Var("affiliations", v.Affiliations)
+	}
+}
+
+// InstallationDiscoveryQuery is the document of query InstallationDiscovery.
+const InstallationDiscoveryQuery = `
+query InstallationDiscovery ($ids: [ID!]!) {
+  nodes(ids: $ids) {
+    ... Repository
+  }
+  rateLimit {
+    ... RateLimit
+  }
+}
+fragment RateLimit on RateLimit {
+  cost
+  limit
+  remaining
+  resetAt
+}
+fragment Repository on Repository {
+  name
+  url
+  id
+  sshUrl
+  isFork
+  isArchived
+  isDisabled
+  isLocked
+  visibility
+  diskUsage
+  owner {
+    login
+  }
+  repositoryTopics(first: 100) {
+    totalCount
+    nodes {
+      topic {
+        name
+      }
+    }
+  }
+  refs(first: 100, refPrefix: "refs/heads/") {
+    totalCount
+    nodes {
+      name
+      target {
+        ... on Commit {
+          oid
+          committedDate
+        }
+      }
+    }
+  }
+  tags: refs(first: 100, refPrefix: "refs/tags/", orderBy: {field:TAG_COMMIT_DATE,direction:DESC}) {
+    nodes {
+      ... TagRef
+    }
+  }
+  releases(first: 20, orderBy: {field:CREATED_AT,direction:DESC}) {
+    nodes {
+      tagName
+      isDraft
+      publishedAt
+      tagCommit {
+        oid
+      }
+    }
+  }
+}
+fragment TagRef on Ref {
+  name
+  target {
+    ... on Commit {
+      oid
+      committedDate
+    }
+    ... on Tag {
+      tagger {
+        date
+      }
+      target {
+        ... on Commit {
+          oid
+          committedDate
+        }
+      }
+    }
+  }
+}
+`
+
+// InstallationDiscoveryResponse is the data returned by query InstallationDiscovery.
+type InstallationDiscoveryResponse struct {
+	Nodes     []*Repository `json:"nodes"`
+	RateLimit RateLimit     `json:"rateLimit"`
+}
+
+// InstallationDiscoveryVariables are the variables of query InstallationDiscovery.
+type InstallationDiscoveryVariables struct {
+	Ids []string
+}
+
+// Set assigns the variables to req, leaving out unset optional ones.
+func (v *InstallationDiscoveryVariables) Set(req *graphql.Request) {
+	req.Var("ids", v.Ids)
+}
+
+// CreateCheckRunQuery is the document of mutation CreateCheckRun.
+const CreateCheckRunQuery = `
+mutation CreateCheckRun ($repositoryId: ID!, $headSha: GitObjectID!, $name: String!, $conclusion: CheckConclusionState!, $completedAt: DateTime!, $title: String!, $summary: String!) {
+  createCheckRun(input: {repositoryId:$repositoryId,headSha:$headSha,name:$name,status:COMPLETED,conclusion:$conclusion,completedAt:$completedAt,output:{title:$title,summary:$summary}}) {
+    checkRun {
+      id
+      url
+    }
+  }
+}
+`
+
+// CreateCheckRunResponse is the data returned by mutation CreateCheckRun.
+type CreateCheckRunResponse struct {
+	CreateCheckRun struct {
+		CheckRun struct {
+			ID  string `json:"id"`
+			URL string `json:"url"`
+		} `json:"checkRun"`
+	} `json:"createCheckRun"`
+}
+
+// CreateCheckRunVariables are the variables of mutation CreateCheckRun.
+type CreateCheckRunVariables struct {
+	RepositoryID string
+	HeadSHA      string
+	Name         string
+	Conclusion   CheckConclusionState
+	CompletedAt  time.Time
+	Title        string
+	Summary      string
+}
+
+// Set assigns the variables to req, leaving out unset optional ones.
+func (v *CreateCheckRunVariables) Set(req *graphql.Request) {
+	req.Var("repositoryId", v.RepositoryID)
+	req.Var("headSha", v.HeadSHA)
+	req.Var("name", v.Name)
+	req.Var("conclusion", v.Conclusion)
+	req.Var("completedAt", v.CompletedAt)
+	req.Var("title", v.Title)
+	req.Var("summary", v.Summary)
+}
+
+// ViewerQuery is the document of query Viewer.
+const ViewerQuery = `
+query Viewer {
+  viewer {
+    login
+  }
+}
+`
+
+// ViewerResponse is the data returned by query Viewer.
+type ViewerResponse struct {
+	Viewer struct {
+		Login string `json:"login"`
+	} `json:"viewer"`
+}
+
+// PropsIssuesQuery is the document of query PropsIssues.
+const PropsIssuesQuery = `
+query PropsIssues ($owner: String!, $name: String!, $createdBy: String!) {
+  repository(owner: $owner, name: $name) {
+    issues(first: 100, states: [OPEN], filterBy: {createdBy:$createdBy}) {
+      nodes {
+        id
+        number
+        body
+      }
+    }
+  }
+}
+`
+
+// PropsIssuesResponse is the data returned by query PropsIssues.
+type PropsIssuesResponse struct {
+	Repository struct {
+		Issues struct {
+			Nodes []*struct {
+				ID     string `json:"id"`
+				Number int    `json:"number"`
+				Body   string `json:"body"`
+			} `json:"nodes"`
+		} `json:"issues"`
+	} `json:"repository"`
+}
+
+// PropsIssuesVariables are the variables of query PropsIssues.
+type PropsIssuesVariables struct {
+	Owner     string
+	Name      string
+	CreatedBy string
+}
+
+// Set assigns the variables to req, leaving out unset optional ones.
+func (v *PropsIssuesVariables) Set(req *graphql.Request) {
+	req.Var("owner", v.Owner)
+	req.Var("name", v.Name)
+	req.Var("createdBy", v.CreatedBy)
+}
+
+// CreateIssueQuery is the document of mutation CreateIssue.
+const CreateIssueQuery = `
+mutation CreateIssue ($repositoryId: ID!, $title: String!, $body: String!) {
+  createIssue(input: {repositoryId:$repositoryId,title:$title,body:$body}) {
+    issue {
+      number
+      url
+    }
+  }
+}
+`
+
+// CreateIssueResponse is the data returned by mutation CreateIssue.
+type CreateIssueResponse struct {
+	CreateIssue struct {
+		Issue struct {
+			Number int    `json:"number"`
+			URL    string `json:"url"`
+		} `json:"issue"`
+	} `json:"createIssue"`
+}
+
+// CreateIssueVariables are the variables of mutation CreateIssue.
+type CreateIssueVariables struct {
+	RepositoryID string
+	Title        string
+	Body         string
+}
+
+// Set assigns the variables to req, leaving out unset optional ones.
+func (v *CreateIssueVariables) Set(req *graphql.Request) {
+	req.Var("repositoryId", v.RepositoryID)
+	req.Var("title", v.Title)
+	req.Var("body", v.Body)
+}
+
+// UpdateIssueQuery is the document of mutation UpdateIssue.
+const UpdateIssueQuery = `
+mutation UpdateIssue ($id: ID!, $body: String!) {
+  updateIssue(input: {id:$id,body:$body}) {
+    issue {
+      number
+    }
+  }
+}
+`
+
+// UpdateIssueResponse is the data returned by mutation UpdateIssue.
+type UpdateIssueResponse struct {
+	UpdateIssue struct {
+		Issue struct {
+			Number int `json:"number"`
+		} `json:"issue"`
+	} `json:"updateIssue"`
+}
+
+// UpdateIssueVariables are the variables of mutation UpdateIssue.
+type UpdateIssueVariables struct {
+	ID   string
+	Body string
+}
+
+// Set assigns the variables to req, leaving out unset optional ones.
+func (v *UpdateIssueVariables) Set(req *graphql.Request) {
+	req.Var("id", v.ID)
+	req.Var("body", v.Body)
+}
+
+// CloseIssueQuery is the document of mutation CloseIssue.
+const CloseIssueQuery = `
+mutation CloseIssue ($id: ID!, $body: String!) {
+  addComment(input: {subjectId:$id,body:$body}) {
+    clientMutationId
+  }
+  closeIssue(input: {issueId:$id}) {
+    issue {
+      number
+    }
+  }
+}
+`
+
+// CloseIssueResponse is the data returned by mutation CloseIssue.
+type CloseIssueResponse struct {
+	AddComment struct {
+		ClientMutationID string `json:"clientMutationId"`
+	} `json:"addComment"`
+	CloseIssue struct {
+		Issue struct {
+			Number int `json:"number"`
+		} `json:"issue"`
+	} `json:"closeIssue"`
+}
+
+// CloseIssueVariables are the variables of mutation CloseIssue.
+type CloseIssueVariables struct {
+	ID   string
+	Body string
+}
+
+// Set assigns the variables to req, leaving out unset optional ones.
+func (v *CloseIssueVariables) Set(req *graphql.Request) {
+	req.Var("id", v.ID)
+	req.Var("body", v.Body)
+}
+
+// CheckConclusionState is the GraphQL enum CheckConclusionState.
+type CheckConclusionState string
+
+// CheckConclusionState values.
+const (
+	CheckConclusionStateActionRequired CheckConclusionState = "ACTION_REQUIRED"
+	CheckConclusionStateCancelled      CheckConclusionState = "CANCELLED"
+	CheckConclusionStateFailure        CheckConclusionState = "FAILURE"
+	CheckConclusionStateNeutral        CheckConclusionState = "NEUTRAL"
+	CheckConclusionStateSkipped        CheckConclusionState = "SKIPPED"
+	CheckConclusionStateStale          CheckConclusionState = "STALE"
+	CheckConclusionStateStartupFailure CheckConclusionState = "STARTUP_FAILURE"
+	CheckConclusionStateSuccess        CheckConclusionState = "SUCCESS"
+	CheckConclusionStateTimedOut       CheckConclusionState = "TIMED_OUT"
+)
+
+// RepositoryAffiliation is the GraphQL enum RepositoryAffiliation.
+type RepositoryAffiliation string
+
+// RepositoryAffiliation values.
+const (
+	RepositoryAffiliationCollaborator       RepositoryAffiliation = "COLLABORATOR"
+	RepositoryAffiliationOrganizationMember RepositoryAffiliation = "ORGANIZATION_MEMBER"
+	RepositoryAffiliationOwner              RepositoryAffiliation = "OWNER"
+)
+
+// RepositoryVisibility is the GraphQL enum RepositoryVisibility.
+type RepositoryVisibility string
+
+// RepositoryVisibility values.
+const (
+	RepositoryVisibilityInternal RepositoryVisibility = "INTERNAL"
+	RepositoryVisibilityPrivate  RepositoryVisibility = "PRIVATE"
+	RepositoryVisibilityPublic   RepositoryVisibility = "PUBLIC"
+)
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/idletekz/go-graphql/discovery"
+	"github.com/idletekz/go-graphql/gql"
+	"github.com/machinebox/graphql"
+)
+
+// issueMarker identifies, in their body, the issues opened by issueTracker.
+const issueMarker = "<!-- go-graphql:props -->"
+
+// issueTracker keeps one issue open per repository while the props file of
+// any of its evaluated refs is missing or unparsable, and closes it once
+// they are all readable again.
+type issueTracker struct {
+	client *graphql.Client
+	path   string
+	login  string
+	repos  []string // owner/name, in evaluation order
+	result map[string]*issueResult
+}
+
+type issueResult struct {
+	repo   *discovery.Repo
+	broken []string // one line per broken ref
+}
+
+func newIssueTracker(ctx context.Context, client *graphql.Client, path string) (*issueTracker, error) {
+	login, err := tokens.login(ctx, client)
+	if err != nil {
+		return nil, fmt.Errorf("newIssueTracker: %s", err)
+	}
+	return &issueTracker{
+		client: client,
+		path:   path,
+		login:  login,
+		result: make(map[string]*issueResult),
+	}, nil
+}
+
+// add records the evaluation of r; err is nil when its props file was read.
+func (it *issueTracker) add(r *discovery.Repo, err error) {
+	key := r.Owner + "/" + r.Name
+	res, ok := it.result[key]
+	if !ok {
+		res = &issueResult{repo: r}
+		it.result[key] = res
+		it.repos = append(it.repos, key)
+	}
+	if err != nil {
+		res.broken = append(res.broken, fmt.Sprintf("- `%s` (%s %s): %s", r.Branch, r.Kind, short(r.SHA), err))
+	}
+}
+
+// sync opens, updates or closes the issue of every recorded repository.
+// Failures, such as repositories with issues disabled, are logged and do
+// not stop the others. Issues are written with the primary token, whose
+// login the tracker looks for.
+func (it *issueTracker) sync(ctx context.Context) {
+	ctx = withPrimaryToken(ctx)
+	for _, key := range it.repos {
+		res := it.result[key]
+		if err := it.syncRepo(ctx, res); err != nil {
+			slog.Error("issue sync failed", "owner", res.repo.Owner, "repo", res.repo.Name, "err", err)
+		}
+	}
+}
+
+func (it *issueTracker) syncRepo(ctx context.Context, res *issueResult) error {
+	r := res.repo
+	req := graphql.NewRequest(gql.PropsIssuesQuery)
+	(&gql.PropsIssuesVariables{Owner: r.Owner, Name: r.Name, CreatedBy: it.login}).Set(req)
+	var issues gql.PropsIssuesResponse
+	if err := it.client.Run(ctx, req, &issues); err != nil {
+		return err
+	}
+	var id string
+	var body string
+	for _, issue := range issues.Repository.Issues.Nodes {
+		if strings.Contains(issue.Body, issueMarker) {
+			id, body = issue.ID, issue.Body
+			break
+		}
+	}
+
+	if len(res.broken) == 0 {
+		if id == "" {
+			return nil
+		}
+		req := graphql.NewRequest(gql.CloseIssueQuery)
+		(&gql.CloseIssueVariables{ID: id, Body: fmt.Sprintf("`%s` can be read on all evaluated refs again.", it.path)}).Set(req)
+		return it.client.Run(ctx, req, &gql.CloseIssueResponse{})
+	}
+
+	want := it.body(res)
+	switch {
+	case id == "":
+		req := graphql.NewRequest(gql.CreateIssueQuery)
+		(&gql.CreateIssueVariables{
+			RepositoryID: r.ID,
+			Title:        fmt.Sprintf("%s is missing or broken", it.path),
+			Body:         want,
+		}).Set(req)
+		return it.client.Run(ctx, req, &gql.CreateIssueResponse{})
+	case body != want:
+		req := graphql.NewRequest(gql.UpdateIssueQuery)
+		(&gql.UpdateIssueVariables{ID: id, Body: want}).Set(req)
+		return it.client.Run(ctx, req, &gql.UpdateIssueResponse{})
+	}
+	return nil
+}
+
+func (it *issueTracker) body(res *issueResult) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\n`%s` could not be read on the following refs:\n\n", issueMarker, it.path)
+	for _, line := range res.broken {
+		fmt.Fprintf(&b, "%s\n", line)
+	}
+	fmt.Fprintf(&b, "\nThis issue is updated on every run and closed once `%s` can be read on all of them.\n", it.path)
+	return b.String()
+}
+
+// short abbreviates a commit oid.
+func short(sha string) string {
+	if len(sha) > 7 {
+		return sha[:7]
+	}
+	return sha
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/idletekz/go-graphql/discovery"
+	"github.com/machinebox/graphql"
+)
+
+// TestIssueSyncContinues checks that a repository with issues disabled
+// does not keep the issues of the next ones from being opened.
+func TestIssueSyncContinues(t *testing.T) {
+	var created []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Query     string
+			Variables map[string]string
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Error(err)
+		}
+		switch {
+		case strings.Contains(body.Query, "query PropsIssues") && body.Variables["name"] == "disabled":
+			fmt.Fprint(w, `{"errors": [{"message": "Repository has issues disabled"}]}`)
+		case strings.Contains(body.Query, "query PropsIssues"):
+			fmt.Fprint(w, `{"data": {"repository": {"issues": {"nodes": []}}}}`)
+		case strings.Contains(body.Query, "mutation CreateIssue"):
+			created = append(created, body.Variables["repositoryId"])
+			fmt.Fprint(w, `{"data": {"createIssue": {"issue": {"number": 1}}}}`)
+		default:
+			t.Errorf("unexpected query %s", body.Query)
+		}
+	}))
+	defer srv.Close()
+	it := &issueTracker{client: graphql.NewClient(srv.URL), path: "props.yml", login: "bot", result: make(map[string]*issueResult)}
+	for _, name := range []string{"disabled", "r1", "r2"} {
+		it.add(&discovery.Repo{ID: name, Owner: "o", Name: name, Branch: "main"}, errors.New("not found"))
+	}
+	it.sync(context.Background())
+	if strings.Join(created, " ") != "r1 r2" {
+		t.Errorf("issues created in %q, want r1 and r2", created)
+	}
+}
+
+// TestIssueSync checks the mutations made for repositories with and
+// without an issue of the tracker, with and without broken refs.
+func TestIssueSync(t *testing.T) {
+	it := &issueTracker{path: "props.yml", login: "bot", result: make(map[string]*issueResult)}
+	broken := errors.New("not found")
+	it.add(&discovery.Repo{ID: "R_same", Owner: "o", Name: "same", Branch: "main", Kind: discovery.KindBranch, SHA: "abcdef123"}, broken)
+	same := it.body(it.result["o/same"])
+	issues := map[string]string{ // open issues of the bot, by repository
+		"same":    `[{"id": "I_same", "body": ` + strconv.Quote(same) + `}]`,
+		"changed": `[{"id": "I_changed", "body": "` + issueMarker + ` old"}]`,
+		"fixed":   `[{"id": "I_fixed", "body": "` + issueMarker + ` old"}]`,
+		"other":   `[{"id": "I_other", "body": "unrelated"}]`,
+		"new":     `[]`,
+		"fine":    `[]`,
+	}
+	var mutations []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Query     string
+			Variables map[string]string
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Error(err)
+		}
+		v := body.Variables
+		switch {
+		case strings.Contains(body.Query, "query PropsIssues"):
+			if v["createdBy"] != "bot" {
+				t.Errorf("issues listed for %q, want bot", v["createdBy"])
+			}
+			fmt.Fprintf(w, `{"data": {"repository": {"issues": {"nodes": %s}}}}`, issues[v["name"]])
+		case strings.Contains(body.Query, "mutation CreateIssue"):
+			if !strings.Contains(v["body"], issueMarker) || !strings.Contains(v["body"], "`main` (branch abcdef1): not found") {
+				t.Errorf("issue body:\n%s", v["body"])
+			}
+			mutations = append(mutations, "create "+v["repositoryId"])
+			fmt.Fprint(w, `{"data": {"createIssue": {"issue": {"number": 1}}}}`)
+		case strings.Contains(body.Query, "mutation UpdateIssue"):
+			mutations = append(mutations, "update "+v["id"])
+			fmt.Fprint(w, `{"data": {"updateIssue": {"issue": {"number": 1}}}}`)
+		case strings.Contains(body.Query, "mutation CloseIssue"):
+			mutations = append(mutations, "close "+v["id"])
+			fmt.Fprint(w, `{"data": {"closeIssue": {"issue": {"number": 1}}}}`)
+		default:
+			t.Errorf("unexpected query %s", body.Query)
+		}
+	}))
+	defer srv.Close()
+	it.client = graphql.NewClient(srv.URL)
+	for _, name := range []string{"changed", "other", "new"} {
+		it.add(&discovery.Repo{ID: "R_" + name, Owner: "o", Name: name, Branch: "main", Kind: discovery.KindBranch, SHA: "abcdef123"}, broken)
+	}
+	for _, name := range []string{"fixed", "fine"} {
+		it.add(&discovery.Repo{ID: "R_" + name, Owner: "o", Name: name, Branch: "main"}, nil)
+	}
+	it.sync(context.Background())
+	want := "update I_changed create R_other create R_new close I_fixed"
+	if got := strings.Join(mutations, " "); got != want {
+		t.Errorf("mutations %q, want %q", got, want)
+	}
+}
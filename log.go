@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/idletekz/go-graphql/discovery"
+)
+
+// redacted replaces secrets in log output.
+const redacted = "REDACTED"
+
+var (
+	secretsMu sync.RWMutex
+	secrets   []string
+
+	// bearerRE matches bearer credentials, as in Authorization headers.
+	bearerRE = regexp.MustCompile(`(?i)(bearer)(\s+)[^\s"'\]]+`)
+	// userinfoRE matches the credentials of URLs, as in clone URLs.
+	userinfoRE = regexp.MustCompile(`(\w+://)[^/@\s]+@`)
+)
+
+// addSecret registers s to be redacted from the logs.
+func addSecret(s string) {
+	if s == "" {
+		return
+	}
+	secretsMu.Lock()
+	defer secretsMu.Unlock()
+	secrets = append(secrets, s)
+}
+
+// redact replaces the registered secrets, bearer credentials and URL
+// credentials in s.
+func redact(s string) string {
+	secretsMu.RLock()
+	for _, secret := range secrets {
+		s = strings.Replace(s, secret, redacted, -1)
+	}
+	secretsMu.RUnlock()
+	s = bearerRE.ReplaceAllString(s, "${1}${2}"+redacted)
+	return userinfoRE.ReplaceAllString(s, "${1}"+redacted+"@")
+}
+
+// setupLogging makes the default logger write, to w, records of level and
+// above in format, text or json, with secrets redacted. The log package
+// writes through it too.
+func setupLogging(w io.Writer, format, level string) error {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return fmt.Errorf("setupLogging: unknown level %q, want debug, info, warn or error", level)
+	}
+	opts := &slog.HandlerOptions{Level: l, ReplaceAttr: redactAttr}
+	var h slog.Handler
+	switch format {
+	case "text":
+		h = slog.NewTextHandler(w, opts)
+	case "json":
+		h = slog.NewJSONHandler(w, opts)
+	default:
+		return fmt.Errorf("setupLogging: unknown format %q, want text or json", format)
+	}
+	slog.SetDefault(slog.New(h))
+	return nil
+}
+
+func redactAttr(groups []string, a slog.Attr) slog.Attr {
+	switch v := a.Value.Resolve(); {
+	case v.Kind() == slog.KindString:
+		a.Value = slog.StringValue(redact(v.String()))
+	case v.Kind() == slog.KindAny:
+		switch x := v.Any().(type) {
+		case error:
+			a.Value = slog.StringValue(redact(x.Error()))
+		case fmt.Stringer:
+			a.Value = slog.StringValue(redact(x.String()))
+		}
+	}
+	return a
+}
+
+// fatal logs msg at the error level and exits.
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	exit(1)
+}
+
+// repoLogger returns the default logger with the fields identifying r.
+func repoLogger(r *discovery.Repo) *slog.Logger {
+	return slog.With(r.Attrs()...)
+}
+
+// debugTransport logs, at the debug level, the requests made through it,
+// their response status and duration.
+type debugTransport struct {
+	next http.RoundTripper
+}
+
+func (t debugTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	if !slog.Default().Enabled(ctx, slog.LevelDebug) {
+		return t.next.RoundTrip(req)
+	}
+	start := time.Now()
+	res, err := t.next.RoundTrip(req)
+	args := []any{"method", req.Method, "url", req.URL.String(), "duration", time.Since(start)}
+	if err != nil {
+		slog.DebugContext(ctx, "http request failed", append(args, "err", err)...)
+		return nil, err
+	}
+	slog.DebugContext(ctx, "http request", append(args, "status", res.StatusCode)...)
+	return res, nil
+}
+
+// httpTransport is the transport of the HTTP clients.
+var httpTransport http.RoundTripper = debugTransport{next: baseTransport}
+
+// graphqlLog logs the GraphQL traffic, headers included, at the debug level.
+func graphqlLog(s string) {
+	slog.Debug("graphql", "traffic", s)
+}
@@ -2,322 +2,297 @@ package main
 
 import (
 	"context"
-	"encoding/json"
+	"flag"
 	"fmt"
-	"github.com/machinebox/graphql"
-	"gopkg.in/yaml.v2"
-	"io/ioutil"
+	"iter"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
-	"os/exec"
+	"os/signal"
 	"path/filepath"
-	"strings"
+	"syscall"
 	"time"
-)
-
-const search = `
-query { 
-  viewer { 
-    login
-    repositories(first: 100, isFork:false, affiliations:[OWNER, ORGANIZATION_MEMBER]) {
-    	totalCount
-    	pageInfo {
-    		endCursor
-    		hasNextPage
-    	}
-    	nodes {
-    		name
-    		url
-    		id
-    		sshUrl
-    		owner {
-    			login
-    		}    		
-        repositoryTopics(first: 100) {
-          nodes {
-            topic {
-              name
-            }
-          }
-        }    		
-    		refs(first: 100, refPrefix: "refs/heads/") {
-    			totalCount
-    			nodes {
-    				name
-    				target {
-    					...on Commit {
-    						committedDate
-    					}
-    				}
-    			}
-    		}
-    	}
-    }
-  }
-}`
 
-const nextSearch = `
-query($after :String!) { 
-  viewer { 
-    login
-    repositories(first: 100, isFork:false,after:$after, affiliations:[OWNER, ORGANIZATION_MEMBER]) {
-    	totalCount
-    	pageInfo {
-    		endCursor
-    		hasNextPage
-    	}
-    	nodes {
-    		name
-    		url
-    		id
-    		sshUrl
-    		owner {
-    			login
-    		}
-        repositoryTopics(first: 100) {
-        	totalCount
-          nodes {
-            topic {
-              name
-            }
-          }
-        }    		
-    		refs(first: 100, refPrefix: "refs/heads/") {
-    			totalCount
-    			nodes {
-    				name
-    				target {
-    					...on Commit {
-    						committedDate
-    					}
-    				}
-    			}
-    		}
-    	}
-    }
-  }
-}`
+	"github.com/idletekz/go-graphql/clone"
+	"github.com/idletekz/go-graphql/discovery"
+	"github.com/idletekz/go-graphql/fetch"
+	"github.com/idletekz/go-graphql/props"
+	"github.com/machinebox/graphql"
+)
 
-// Response ...
-type Response struct {
-	Viewer struct {
-		Login        string
-		Repositories struct {
-			TotalCount int
-			PageInfo   struct {
-				EndCursor   string
-				HasNextPage bool
-			}
-			Nodes []*Repository
-		}
+func main() {
+	configPath := flag.String("config", "", "path to the YAML configuration file")
+	topic := flag.String("topic", "go", "repository topic to look for")
+	forks := flag.Bool("forks", false, "include forked repositories")
+	affiliations := flag.String("affiliations", "OWNER,ORGANIZATION_MEMBER", "comma separated repository affiliations: OWNER, COLLABORATOR, ORGANIZATION_MEMBER")
+	visibility := flag.String("visibility", "", "comma separated repository visibilities to keep: PUBLIC, PRIVATE, INTERNAL (default any)")
+	archived := flag.Bool("archived", false, "include archived repositories")
+	locked := flag.Bool("locked", false, "include locked repositories")
+	backend := flag.String("git", "", "git backend used to clone: exec (git binary, default), go (in process) or tarball (no history)")
+	pruneStale := flag.Bool("prune", false, "remove the clone directories of refs that are no longer active")
+	pruneList := flag.Bool("prune-list", false, "list the clone directories -prune would remove, without removing them")
+	run := flag.Bool("run", false, "run the commands of the configuration file in every clone")
+	issues := flag.Bool("issues", false, "open, update and close an issue in repositories whose props file is missing or unparsable")
+	report := flag.String("report", "", "publish props validation results on the evaluated commit: status (commit status) or check (check run, needs GitHub App auth)")
+	logFormat := flag.String("log-format", "text", "log format: text or json")
+	logLevel := flag.String("log-level", "info", "log level: debug (GraphQL and HTTP traffic included), info, warn or error")
+	metricsAddr := flag.String("metrics-addr", "", "serve Prometheus metrics on this address, at /metrics, while running")
+	flag.StringVar(&metricsFile, "metrics-file", "", "write Prometheus metrics to this file on exit, for the node exporter textfile collector")
+	dryRun := flag.Bool("dry-run", false, "discover active refs and print where they would be cloned and which files would be fetched, without cloning, fetching or writing anything; -prune only lists")
+	cacheDir := flag.String("cache-dir", defaultCacheDir(), "directory of the cache of files fetched by commit, empty to disable it")
+	flag.Parse()
+	if *dryRun {
+		metricsFile = ""
 	}
-}
-
-// Repository struct
-type Repository struct {
-	Name   string
-	URL    string
-	ID     string
-	SSHURL string
-	Owner  struct {
-		Login string
-	}
-	RepositoryTopics struct {
-		Nodes []struct {
-			Topic struct {
-				Name string
-			}
-		}
+	if err := setupLogging(os.Stderr, *logFormat, *logLevel); err != nil {
+		log.Fatal(err)
 	}
-	Refs struct {
-		TotalCount int
-		Nodes      []struct {
-			Name   string
-			Target struct {
-				CommittedDate time.Time
-			}
-		}
+	if *metricsAddr != "" {
+		serveMetrics(*metricsAddr)
 	}
-}
-
-// Repo  ...
-type Repo struct {
-	Name   string
-	URL    string
-	SSHURL string
-	Branch string
-	Owner  string
-}
-
-// T Note: struct fields must be public in order for unmarshal to
-// correctly populate the data.
-type T struct {
-	AppID   string `yaml:"appID"`
-	AppName string `yaml:"appName"`
-	Check   struct {
-		Team     string `yaml:"team"`
-		Instance string
-		Enable   bool
+	// The first SIGINT or SIGTERM cancels ctx for a graceful shutdown; the
+	// next one kills the process.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	config, err := loadConfig(*configPath)
+	if err != nil {
+		fatal(err.Error())
 	}
-}
-
-var token = os.Getenv("GITHUB_TOKEN")
-var yesterday = time.Now().AddDate(0, 0, -1)
-var rawContentURL = map[string]string{
-	"github.com": "https://raw.githubusercontent.com",
-}
-
-func main() {
-	repos, err := activities("go")
+	if err := setupHTTP(&config.HTTP); err != nil {
+		fatal(err.Error())
+	}
+	if err := setAPIURL(config.APIURL); err != nil {
+		fatal(err.Error())
+	}
+	if tokens, err = newTokenSource(ctx, &config.Auth); err != nil {
+		fatal(err.Error())
+	}
+	credentialEnv = append(config.Auth.envNames(), config.Notify.envNames()...)
+	if *backend != "" {
+		config.Clone.Backend = *backend
+	}
+	if err := config.Clone.Validate(); err != nil {
+		fatal(err.Error())
+	}
+	cloner := &clone.Cloner{
+		Config:  config.Clone,
+		Network: config.HTTP.network(),
+		Token:   tokens.token,
+		Client:  &http.Client{Transport: apiTransport, Timeout: 30 * time.Minute},
+		APIURL:  restURL,
+	}
+	rf, err := newRepoFilter(*forks, *affiliations, *visibility, *archived, *locked)
 	if err != nil {
-		log.Fatal(err)
+		fatal(err.Error())
 	}
-	for _, repo := range repos {
-		fmt.Printf("%#v\n", repo)
-		err := repo.clone()
-		if err != nil {
-			log.Fatal(err)
+	filter, err := config.branchFilter(*topic)
+	if err != nil {
+		fatal(err.Error())
+	}
+	client := graphql.NewClient(graphqlURL, graphql.WithHTTPClient(&http.Client{Transport: apiTransport}))
+	client.Log = graphqlLog
+	if err := tokens.validate(ctx, client); err != nil {
+		fatal(err.Error())
+	}
+	rep, err := newReporter(*report, &config.Auth, client)
+	if err != nil {
+		fatal(err.Error())
+	}
+	notifiers, err := config.Notify.notifiers()
+	if err != nil {
+		fatal(err.Error())
+	}
+	var tracker *issueTracker
+	if *issues {
+		if tracker, err = newIssueTracker(withPrimaryToken(ctx), client, props.Path); err != nil {
+			fatal(err.Error())
 		}
-		data, err := repo.raw("props.yml")
+	}
+	opts := discovery.Options{
+		Topic:    *topic,
+		Repos:    rf,
+		Branches: filter,
+		OnPage:   recordDiscovery,
+	}
+	if config.Auth.App != nil {
+		opts.Installation = &discovery.Installation{Client: &http.Client{Transport: apiTransport}, APIURL: restURL}
+	}
+	// Refs are cloned as discovery pages arrive, unless pruning, which
+	// needs all of them first.
+	pages := discovery.Pages(withPrimaryToken(ctx), client, opts)
+	if *pruneStale || *pruneList {
+		all, err := discovery.Active(withPrimaryToken(ctx), client, opts)
 		if err != nil {
-			log.Fatal(err)
+			fatal(err.Error())
 		}
-		fmt.Println(data)
-		t := T{}
-		err = yaml.Unmarshal([]byte(data), &t)
+		root, err := config.Clone.Root()
 		if err != nil {
-			log.Fatalf("error: %v", err)
+			fatal(err.Error())
+		}
+		if err := clone.Prune(root, all, *pruneList || *dryRun, os.Stdout); err != nil {
+			fatal(err.Error())
 		}
-		fmt.Printf("--- t:\n%v\n\n", t)
-		repo.clone()
+		pages = onePage(all)
 	}
-}
-
-func pp(respData *Response) {
-	data, err := json.MarshalIndent(respData, "", "  ")
+	q, err := clone.NewQuota(&config.Clone)
 	if err != nil {
-		log.Fatalf("JSON marshaling failed: %s", err)
+		fatal(err.Error())
 	}
-	fmt.Printf("%s\n", data)
-}
-
-func activities(topic string) (repos []*Repo, err error) {
-	client := graphql.NewClient("https://api.github.com/graphql")
-	// client.Log = func(s string) { log.Println(s) }
-	ctx := context.Background()
-	req := graphql.NewRequest(search)
-	req.Header.Add("Authorization", "Bearer "+token)
-	var respData Response
-	if err = client.Run(ctx, req, &respData); err != nil {
-		return nil, err
-	}
-	repos = activeTopic(respData.Viewer.Repositories.Nodes, topic)
-	for respData.Viewer.Repositories.PageInfo.HasNextPage {
-		req := graphql.NewRequest(nextSearch)
-		req.Header.Add("Authorization", "Bearer "+token)
-		req.Var("after", respData.Viewer.Repositories.PageInfo.EndCursor)
-		if err := client.Run(ctx, req, &respData); err != nil {
-			return nil, err
+	if *dryRun {
+		root, err := config.Clone.Root()
+		if err != nil {
+			fatal(err.Error())
+		}
+		var cmds []Command
+		if *run {
+			cmds = config.Run
+		}
+		if err := printPlan(os.Stdout, pages, root, q, props.Path, cmds); err != nil {
+			fatal(err.Error())
 		}
-		tRepos := activeTopic(respData.Viewer.Repositories.Nodes, topic)
-		repos = append(repos, tRepos...)
+		exit(0)
 	}
-	return
-}
-
-// ActiveTopic collect active repositories with specified topic
-func activeTopic(repositories []*Repository, topic string) (active []*Repo) {
-	for _, repo := range repositories {
-		for _, node := range repo.RepositoryTopics.Nodes {
-			if node.Topic.Name == topic {
-				for _, branch := range repo.Refs.Nodes {
-					if branch.Target.CommittedDate.After(yesterday) {
-						r := &Repo{
-							Name:   repo.Name,
-							Branch: branch.Name,
-							SSHURL: repo.SSHURL,
-							URL:    repo.URL,
-							Owner:  repo.Owner.Login,
-						}
-						active = append(active, r)
-					}
-				}
+	fetcher := &fetch.Fetcher{Client: client, Observe: observeBlobs}
+	if *cacheDir != "" {
+		fetcher.Cache = &fetch.Cache{Dir: filepath.Join(*cacheDir, "blobs")}
+	}
+	var active []*discovery.Repo
+	var results []*result
+	var runs []*runResult
+	for page, err := range pages {
+		if ctx.Err() != nil {
+			break
+		}
+		if err != nil {
+			fatal(err.Error())
+		}
+		active = append(active, page...)
+		found, err := fetcher.Files(forRepos(ctx, page...), page, props.Path)
+		if err != nil {
+			fatal(err.Error())
+		}
+		for _, repo := range page {
+			if ctx.Err() != nil {
 				break
 			}
+			rctx := forRepos(ctx, repo)
+			rlog := repoLogger(repo)
+			rlog.Debug("evaluating", "url", repo.URL, "size", repo.Size)
+			var dir string
+			if err := q.Admit(repo); err != nil {
+				rlog.Warn("skipping clone", "err", err)
+			} else {
+				if dir, err = cloneRepo(rctx, cloner, repo); err != nil {
+					fatal("clone failed", "owner", repo.Owner, "repo", repo.Name, "ref", repo.Branch, "err", err)
+				}
+				rlog.Info("cloned", "dir", dir)
+				q.Add(dir)
+			}
+			t, problems, err := evaluate(found, repo, props.Path)
+			rlog.Debug("props", "props", fmt.Sprintf("%+v", t))
+			if tracker != nil {
+				tracker.add(repo, err)
+			}
+			if err != nil {
+				problems = append([]string{err.Error()}, problems...)
+			}
+			results = append(results, &result{Repo: repo, Props: t, Problems: problems})
+			if *run && dir != "" {
+				runs = append(runs, runCommands(ctx, config.Run, repo, dir, t)...)
+			}
+			for _, p := range problems {
+				rlog.Warn("props problem", "problem", p)
+			}
+			if rep != nil {
+				if err := rep.report(ctx, repo, props.Path, problems); err != nil {
+					rlog.Error("report failed", "err", err)
+				}
+			}
+		}
+	}
+	recordActive(active)
+	// Issues and digests of an interrupted run would be based on partial
+	// results.
+	if ctx.Err() != nil {
+		fatal("interrupted")
+	}
+	if tracker != nil {
+		tracker.sync(ctx)
+	}
+	for _, d := range digests(results) {
+		for _, n := range notifiers {
+			if err := n.notify(ctx, d); err != nil {
+				slog.Error("notify failed", "team", d.Team, "err", err)
+			}
 		}
 	}
-	return active
+	if *run && printRunReport(os.Stdout, runs) > 0 {
+		exit(1)
+	}
+	lastSuccess.set(float64(time.Now().Unix()))
+	exit(0)
 }
 
-// https://raw.githubusercontent.com/[USER-NAME]/[REPOSITORY-NAME]/[BRANCH-NAME]/[FILE-PATH]
-func (r *Repo) rawURL() string {
-	s := strings.Split(r.URL, "/")
-	return fmt.Sprintf("%s/%s/%s", rawContentURL[s[2]], s[3], s[4])
+// metricsFile is written by exit when set.
+var metricsFile string
+
+// exit writes the metrics file and exits with code.
+func exit(code int) {
+	if metricsFile != "" {
+		if err := writeMetricsFile(metricsFile); err != nil {
+			slog.Error("writing metrics failed", "err", err)
+		}
+	}
+	os.Exit(code)
 }
 
-func (r *Repo) raw(path string) (string, error) {
-	url := fmt.Sprintf("%s/%s/%s", r.rawURL(), r.Branch, path)
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return "", err
-	}
-	req.Header.Add("Authorization", "Bearer "+token)
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel() // releases resources if operation completes before timeout elapses
-	req = req.WithContext(ctx)
-	client := &http.Client{}
-	res, err := client.Do(req)
+// evaluate parses the props file fetched for r and returns it along with
+// the invalid values found. The error reports a missing or unparsable file.
+func evaluate(found map[*discovery.Repo]*fetch.Blob, r *discovery.Repo, path string) (props.Props, []string, error) {
+	data, err := fetch.Text(found, r, path)
 	if err != nil {
-		return "", err
+		return props.Props{}, nil, fmt.Errorf("props: %s", err)
 	}
-	defer res.Body.Close()
-	if res.StatusCode < 200 || res.StatusCode >= 300 {
-		return "", fmt.Errorf("rawContent status code: %v", res.StatusCode)
-	}
-	bodyText, err := ioutil.ReadAll(res.Body)
+	p, problems, err := props.Parse([]byte(data))
 	if err != nil {
-		return "", fmt.Errorf("rawContent %v", err)
+		return p, nil, fmt.Errorf("%s: %s", path, err)
 	}
-	s := string(bodyText)
-	return s, nil
+	return p, problems, nil
 }
 
-func (r *Repo) clone() error {
-	s := strings.Split(r.URL, "//")
-	repo := fmt.Sprintf("%s//%s@%s", s[0], token, s[1])
-	args := []string{
-		"clone",
-		"--depth=1",
-		"-b",
-		r.Branch,
-		repo,
-	}
-	dir, err := r.createCloneDir()
-	if err != nil {
-		return fmt.Errorf("clone: %s", err)
+// onePage yields repos as a single page, without error.
+func onePage(repos []*discovery.Repo) iter.Seq2[[]*discovery.Repo, error] {
+	return func(yield func([]*discovery.Repo, error) bool) {
+		yield(repos, nil)
 	}
-	cmd := exec.Command("git", args...)
-	cmd.Dir = dir
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	err = cmd.Run()
+}
+
+// defaultCacheDir is the cache directory of the user, or empty when it
+// cannot be determined.
+func defaultCacheDir() string {
+	dir, err := os.UserCacheDir()
 	if err != nil {
-		return err
+		return ""
 	}
-	return nil
+	return filepath.Join(dir, "go-graphql")
 }
 
-func (r *Repo) createCloneDir() (string, error) {
-	var dir string
-	pwd, err := os.Getwd()
-	if err != nil {
-		return dir, fmt.Errorf("createCloneDir getwd: %s", err)
+// cloneRepo clones r with cl, recording the duration and outcome.
+func cloneRepo(ctx context.Context, cl *clone.Cloner, r *discovery.Repo) (string, error) {
+	backend := cl.Backend
+	if backend == "" {
+		backend = "exec"
 	}
-	dir = filepath.Join(pwd, r.Owner, r.Branch)
-	err = os.MkdirAll(dir, 0755)
+	start := time.Now()
+	dir, err := cl.Clone(ctx, r)
+	cloneDuration.since(start, backend)
 	if err != nil {
-		return dir, fmt.Errorf("createCloneDir mkdirall: %s", err)
+		cloneFailures.add(1, backend)
 	}
-	return dir, nil
+	return dir, err
 }
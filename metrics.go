@@ -0,0 +1,263 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/idletekz/go-graphql/discovery"
+	"github.com/idletekz/go-graphql/gql"
+)
+
+// Metrics of a run, in the Prometheus text exposition format. They are
+// served on -metrics-addr while running, and written to -metrics-file, for
+// the node exporter textfile collector, when done.
+var (
+	reposScanned = newMetric("props_repositories_scanned_total", "counter",
+		"Repositories returned by discovery.")
+	activeRefs = newMetric("props_active_refs", "gauge",
+		"Active refs found by the last discovery, by kind.", "kind")
+	cloneDuration = newMetric("props_clone_duration_seconds", "histogram",
+		"Duration of clones, by backend.", "backend")
+	cloneFailures = newMetric("props_clone_failures_total", "counter",
+		"Failed clones, by backend.", "backend")
+	blobDuration = newMetric("props_blob_fetch_duration_seconds", "histogram",
+		"Duration of the GraphQL requests fetching a batch of files.")
+	blobFailures = newMetric("props_blob_fetch_failures_total", "counter",
+		"Failed GraphQL requests fetching a batch of files.")
+	graphqlCost = newMetric("props_graphql_cost_total", "counter",
+		"GraphQL rate limit points spent, by query: discovery or blob.", "query")
+	graphqlRemaining = newMetric("props_graphql_rate_limit_remaining", "gauge",
+		"GraphQL rate limit points left in the current window.")
+	graphqlReset = newMetric("props_graphql_rate_limit_reset_timestamp_seconds", "gauge",
+		"Unix time at which the GraphQL rate limit window resets.")
+	lastSuccess = newMetric("props_last_success_timestamp_seconds", "gauge",
+		"Unix time of the end of the last successful run.")
+)
+
+// durationBuckets are the upper bounds, in seconds, of duration histograms.
+var durationBuckets = []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300, 600}
+
+var metrics []*metric
+
+// metric is a family of series sharing a name, one per set of label values.
+type metric struct {
+	name, kind, help string
+	labels           []string
+
+	mu     sync.Mutex
+	series map[string]*series // by label values joined with "\xff"
+}
+
+type series struct {
+	values []string
+	value  float64  // counter and gauge value, histogram sum
+	counts []uint64 // histogram bucket counts, the last one for +Inf
+}
+
+func newMetric(name, kind, help string, labels ...string) *metric {
+	m := &metric{name: name, kind: kind, help: help, labels: labels, series: make(map[string]*series)}
+	metrics = append(metrics, m)
+	return m
+}
+
+func (m *metric) get(values []string) *series {
+	if len(values) != len(m.labels) {
+		panic(fmt.Sprintf("metric %s: got %d label values, want %d", m.name, len(values), len(m.labels)))
+	}
+	key := strings.Join(values, "\xff")
+	s, ok := m.series[key]
+	if !ok {
+		s = &series{values: values}
+		if m.kind == "histogram" {
+			s.counts = make([]uint64, len(durationBuckets)+1)
+		}
+		m.series[key] = s
+	}
+	return s
+}
+
+// add adds v to the counter or gauge with the label values.
+func (m *metric) add(v float64, values ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.get(values).value += v
+}
+
+// set sets the gauge with the label values to v.
+func (m *metric) set(v float64, values ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.get(values).value = v
+}
+
+// observe records v in the histogram with the label values.
+func (m *metric) observe(v float64, values ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := m.get(values)
+	s.value += v
+	i := sort.SearchFloat64s(durationBuckets, v)
+	s.counts[i]++
+}
+
+// since observes the seconds elapsed since start.
+func (m *metric) since(start time.Time, values ...string) {
+	m.observe(time.Since(start).Seconds(), values...)
+}
+
+func (m *metric) write(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.kind)
+	keys := make([]string, 0, len(m.series))
+	for k := range m.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		s := m.series[k]
+		if m.kind != "histogram" {
+			fmt.Fprintf(w, "%s%s %s\n", m.name, labelPairs(m.labels, s.values), formatFloat(s.value))
+			continue
+		}
+		var count uint64
+		for i, c := range s.counts {
+			count += c
+			le := "+Inf"
+			if i < len(durationBuckets) {
+				le = formatFloat(durationBuckets[i])
+			}
+			labels := labelPairs(append(m.labels[:len(m.labels):len(m.labels)], "le"), append(s.values[:len(s.values):len(s.values)], le))
+			fmt.Fprintf(w, "%s_bucket%s %d\n", m.name, labels, count)
+		}
+		fmt.Fprintf(w, "%s_sum%s %s\n", m.name, labelPairs(m.labels, s.values), formatFloat(s.value))
+		fmt.Fprintf(w, "%s_count%s %d\n", m.name, labelPairs(m.labels, s.values), count)
+	}
+}
+
+func labelPairs(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	escape := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = fmt.Sprintf(`%s="%s"`, name, escape.Replace(values[i]))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// writeMetrics writes all metrics to w.
+func writeMetrics(w io.Writer) {
+	for _, m := range metrics {
+		m.write(w)
+	}
+}
+
+// serveMetrics serves the metrics on addr, at /metrics, in the background.
+func serveMetrics(addr string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		writeMetrics(w)
+	})
+	go func() {
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			slog.Error("metrics server failed", "addr", addr, "err", err)
+		}
+	}()
+}
+
+// writeMetricsFile writes the metrics to path, atomically for collectors
+// reading it concurrently. Unless this run succeeded, the time of the last
+// successful run is carried over from the previous file, so that alerts on
+// its age see it grow rather than the series vanish.
+func writeMetricsFile(path string) error {
+	carryOver(path, lastSuccess)
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return fmt.Errorf("writeMetricsFile: %s", err)
+	}
+	writeMetrics(tmp)
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("writeMetricsFile: %s", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("writeMetricsFile: %s", err)
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// carryOver sets the gauge m, when it has no series, to its value in the
+// metrics file at path, if any.
+func carryOver(path string, m *metric) {
+	m.mu.Lock()
+	n := len(m.series)
+	m.mu.Unlock()
+	if n > 0 {
+		return
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if v, ok := strings.CutPrefix(line, m.name+" "); ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				m.set(f)
+			}
+			return
+		}
+	}
+}
+
+// recordDiscovery updates the metrics with a discovery page.
+func recordDiscovery(repos []*gql.Repository, rl *gql.RateLimit) {
+	reposScanned.add(float64(len(repos)))
+	recordRateLimit("discovery", rl)
+}
+
+// recordRateLimit records the cost of a query and the rate limit after it.
+func recordRateLimit(query string, rl *gql.RateLimit) {
+	if rl == nil {
+		return
+	}
+	graphqlCost.add(float64(rl.Cost), query)
+	graphqlRemaining.set(float64(rl.Remaining))
+	graphqlReset.set(float64(rl.ResetAt.Unix()))
+}
+
+// recordActive counts the active refs by kind.
+func recordActive(repos []*discovery.Repo) {
+	refs := map[discovery.RefKind]int{discovery.KindBranch: 0, discovery.KindTag: 0, discovery.KindRelease: 0}
+	for _, r := range repos {
+		refs[r.Kind]++
+	}
+	for kind, n := range refs {
+		activeRefs.set(float64(n), string(kind))
+	}
+}
+
+// observeBlobs records a request fetching a batch of files.
+func observeBlobs(d time.Duration, rl *gql.RateLimit, err error) {
+	blobDuration.observe(d.Seconds())
+	if err != nil {
+		blobFailures.add(1)
+	}
+	recordRateLimit("blob", rl)
+}
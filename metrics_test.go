@@ -0,0 +1,114 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMetricWrite(t *testing.T) {
+	tests := []struct {
+		metric *metric
+		record func(m *metric)
+		want   string
+	}{
+		{
+			&metric{name: "c_total", kind: "counter", help: "Things.", labels: []string{"kind"}, series: make(map[string]*series)},
+			func(m *metric) {
+				m.add(2, "b")
+				m.add(1, `a"\`+"\n")
+				m.add(0.5, "b")
+			},
+			`# HELP c_total Things.
+# TYPE c_total counter
+c_total{kind="a\"\\\n"} 1
+c_total{kind="b"} 2.5
+`,
+		},
+		{
+			&metric{name: "g", kind: "gauge", help: "Level.", series: make(map[string]*series)},
+			func(m *metric) {
+				m.set(3)
+				m.set(1.25e9)
+			},
+			`# HELP g Level.
+# TYPE g gauge
+g 1.25e+09
+`,
+		},
+		{
+			&metric{name: "d_seconds", kind: "histogram", help: "Durations.", labels: []string{"backend"}, series: make(map[string]*series)},
+			func(m *metric) {
+				m.observe(0.1, "go")
+				m.observe(3, "go")
+				m.observe(1000, "go")
+			},
+			`# HELP d_seconds Durations.
+# TYPE d_seconds histogram
+d_seconds_bucket{backend="go",le="0.1"} 1
+d_seconds_bucket{backend="go",le="0.25"} 1
+d_seconds_bucket{backend="go",le="0.5"} 1
+d_seconds_bucket{backend="go",le="1"} 1
+d_seconds_bucket{backend="go",le="2.5"} 1
+d_seconds_bucket{backend="go",le="5"} 2
+d_seconds_bucket{backend="go",le="10"} 2
+d_seconds_bucket{backend="go",le="30"} 2
+d_seconds_bucket{backend="go",le="60"} 2
+d_seconds_bucket{backend="go",le="120"} 2
+d_seconds_bucket{backend="go",le="300"} 2
+d_seconds_bucket{backend="go",le="600"} 2
+d_seconds_bucket{backend="go",le="+Inf"} 3
+d_seconds_sum{backend="go"} 1003.1
+d_seconds_count{backend="go"} 3
+`,
+		},
+	}
+	for _, tt := range tests {
+		tt.record(tt.metric)
+		var b strings.Builder
+		tt.metric.write(&b)
+		if b.String() != tt.want {
+			t.Errorf("%s:\n%s\nwant:\n%s", tt.metric.name, b.String(), tt.want)
+		}
+	}
+}
+
+func TestWriteMetrics(t *testing.T) {
+	var b strings.Builder
+	writeMetrics(&b)
+	for _, m := range metrics {
+		if !strings.Contains(b.String(), "# TYPE "+m.name+" "+m.kind+"\n") {
+			t.Errorf("output lacks the TYPE line of %s", m.name)
+		}
+	}
+}
+
+func TestWriteMetricsFileKeepsLastSuccess(t *testing.T) {
+	saved := lastSuccess.series
+	defer func() { lastSuccess.series = saved }()
+	lastSuccess.series = make(map[string]*series)
+	path := filepath.Join(t.TempDir(), "props.prom")
+	if err := os.WriteFile(path, []byte("# TYPE props_last_success_timestamp_seconds gauge\nprops_last_success_timestamp_seconds 1.7e+09\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// A failed run.
+	if err := writeMetricsFile(path); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "\nprops_last_success_timestamp_seconds 1.7e+09\n") {
+		t.Errorf("last success lost by a failed run:\n%s", data)
+	}
+	// A successful one.
+	lastSuccess.set(1.8e9)
+	if err := writeMetricsFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ = os.ReadFile(path); !strings.Contains(string(data), "\nprops_last_success_timestamp_seconds 1.8e+09\n") {
+		t.Errorf("last success not updated:\n%s", data)
+	}
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/smtp"
+	"os"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/idletekz/go-graphql/discovery"
+	"github.com/idletekz/go-graphql/props"
+)
+
+// unassigned is the team of results whose props file names no team.
+const unassigned = "unassigned"
+
+// NotifyConfig configures the delivery of per-team digests. A notifier is
+// enabled by its section; teams without an address are skipped by it.
+type NotifyConfig struct {
+	SMTP    *SMTPConfig           `yaml:"smtp"`
+	Webhook *WebhookConfig        `yaml:"webhook"`
+	Teams   map[string]TeamConfig `yaml:"teams"`
+}
+
+// SMTPConfig configures digests sent by mail. The password is read from the
+// environment variable named by PasswordEnv.
+type SMTPConfig struct {
+	Addr        string `yaml:"addr"`
+	From        string `yaml:"from"`
+	Username    string `yaml:"username"`
+	PasswordEnv string `yaml:"passwordEnv"`
+}
+
+// envNames returns the environment variables holding the credentials of c.
+func (c *NotifyConfig) envNames() []string {
+	if c.SMTP == nil || c.SMTP.PasswordEnv == "" {
+		return nil
+	}
+	return []string{c.SMTP.PasswordEnv}
+}
+
+// WebhookConfig configures digests posted to a URL. Template is a
+// text/template rendering the request body from a digest, with a json
+// function quoting its argument; it defaults to defaultWebhookTemplate.
+type WebhookConfig struct {
+	URL      string            `yaml:"url"`
+	Template string            `yaml:"template"`
+	Headers  map[string]string `yaml:"headers"`
+}
+
+// TeamConfig holds the addresses of a team, keyed in NotifyConfig.Teams by
+// the check.team value of the props file.
+type TeamConfig struct {
+	Email   []string `yaml:"email"`
+	Webhook string   `yaml:"webhook"` // overrides WebhookConfig.URL
+}
+
+const defaultWebhookTemplate = `{"team": {{ json .Team }}, "failed": {{ .Failed }}, "text": {{ json .Text }}}`
+
+// result is the evaluation of the props file of a repo.
+type result struct {
+	Repo     *discovery.Repo
+	Props    props.Props
+	Problems []string
+}
+
+// digest gathers the results of a team.
+type digest struct {
+	Team    string
+	Results []*result
+	Failed  int // results with problems
+}
+
+// Text is a plain text account of the digest.
+func (d *digest) Text() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d refs evaluated for team %s, %d with problems.\n", len(d.Results), d.Team, d.Failed)
+	for _, r := range d.Results {
+		status := "ok"
+		if len(r.Problems) > 0 {
+			status = strings.Join(r.Problems, "; ")
+		}
+		fmt.Fprintf(&b, "\n%s/%s@%s: %s", r.Repo.Owner, r.Repo.Name, r.Repo.Branch, status)
+	}
+	return b.String()
+}
+
+// digests groups results by check.team, sorted by team.
+func digests(results []*result) []*digest {
+	byTeam := make(map[string]*digest)
+	for _, r := range results {
+		team := r.Props.Check.Team
+		if team == "" {
+			team = unassigned
+		}
+		d, ok := byTeam[team]
+		if !ok {
+			d = &digest{Team: team}
+			byTeam[team] = d
+		}
+		d.Results = append(d.Results, r)
+		if len(r.Problems) > 0 {
+			d.Failed++
+		}
+	}
+	var list []*digest
+	for _, d := range byTeam {
+		list = append(list, d)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Team < list[j].Team })
+	return list
+}
+
+// notifier delivers a team digest.
+type notifier interface {
+	notify(ctx context.Context, d *digest) error
+}
+
+// notifiers returns the notifiers enabled by c.
+func (c *NotifyConfig) notifiers() ([]notifier, error) {
+	var list []notifier
+	if c.SMTP != nil {
+		list = append(list, &mailNotifier{config: c.SMTP, teams: c.Teams})
+	}
+	if c.Webhook != nil {
+		text := c.Webhook.Template
+		if text == "" {
+			text = defaultWebhookTemplate
+		}
+		tmpl, err := template.New("webhook").Funcs(template.FuncMap{"json": jsonString}).Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("notifiers: %s", err)
+		}
+		list = append(list, &webhookNotifier{
+			config: c.Webhook,
+			teams:  c.Teams,
+			tmpl:   tmpl,
+			client: &http.Client{Transport: httpTransport, Timeout: 10 * time.Second},
+		})
+	}
+	return list, nil
+}
+
+func jsonString(v interface{}) (string, error) {
+	data, err := json.Marshal(v)
+	return string(data), err
+}
+
+// mailNotifier sends digests to the team email addresses.
+type mailNotifier struct {
+	config *SMTPConfig
+	teams  map[string]TeamConfig
+}
+
+func (m *mailNotifier) notify(ctx context.Context, d *digest) error {
+	to := m.teams[d.Team].Email
+	if len(to) == 0 {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(m.config.Addr)
+	if err != nil {
+		return fmt.Errorf("mailNotifier: %s", err)
+	}
+	var auth smtp.Auth
+	if m.config.Username != "" {
+		auth = smtp.PlainAuth("", m.config.Username, os.Getenv(m.config.PasswordEnv), host)
+	}
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", m.config.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&msg, "Subject: props digest for %s: %d of %d refs with problems\r\n", d.Team, d.Failed, len(d.Results))
+	fmt.Fprintf(&msg, "Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(strings.Replace(d.Text(), "\n", "\r\n", -1))
+	ctx, cancel := context.WithTimeout(ctx, mailTimeout)
+	defer cancel()
+	if err := sendMail(ctx, m.config.Addr, host, auth, m.config.From, to, msg.Bytes()); err != nil {
+		return fmt.Errorf("mailNotifier %s: %s", d.Team, err)
+	}
+	return nil
+}
+
+// mailTimeout bounds the delivery of a digest by mail.
+const mailTimeout = 30 * time.Second
+
+// sendMail is smtp.SendMail, giving up when ctx is done.
+func sendMail(ctx context.Context, addr, host string, auth smtp.Auth, from string, to []string, msg []byte) (err error) {
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer func() {
+		if !stop() && ctx.Err() != nil {
+			err = ctx.Err()
+		}
+	}()
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if auth != nil {
+		if err := c.Auth(auth); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(from); err != nil {
+		return err
+	}
+	for _, addr := range to {
+		if err := c.Rcpt(addr); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// webhookNotifier posts digests rendered by tmpl to the team webhook, or
+// to the default URL.
+type webhookNotifier struct {
+	config *WebhookConfig
+	teams  map[string]TeamConfig
+	tmpl   *template.Template
+	client *http.Client
+}
+
+func (w *webhookNotifier) notify(ctx context.Context, d *digest) error {
+	url := w.teams[d.Team].Webhook
+	if url == "" {
+		url = w.config.URL
+	}
+	if url == "" {
+		return nil
+	}
+	var body bytes.Buffer
+	if err := w.tmpl.Execute(&body, d); err != nil {
+		return fmt.Errorf("webhookNotifier %s: %s", d.Team, err)
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", url, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range w.config.Headers {
+		req.Header.Set(k, v)
+	}
+	res, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhookNotifier %s: %s", d.Team, err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("webhookNotifier %s status code: %v", d.Team, res.StatusCode)
+	}
+	return nil
+}
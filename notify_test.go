@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/idletekz/go-graphql/discovery"
+)
+
+func testDigest() *digest {
+	ok := &result{Repo: &discovery.Repo{Owner: "o", Name: "ok", Branch: "main"}}
+	ok.Props.Check.Team = "web"
+	broken := &result{Repo: &discovery.Repo{Owner: "o", Name: "broken", Branch: "dev"}, Problems: []string{"appID is missing"}}
+	broken.Props.Check.Team = "web"
+	return digests([]*result{ok, broken})[0]
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	type request struct {
+		path, auth string
+		body       map[string]any
+	}
+	requests := make(chan request, 2)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Error(err)
+		}
+		requests <- request{r.URL.Path, r.Header.Get("Authorization"), body}
+		if r.URL.Path == "/down" {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer srv.Close()
+	c := &NotifyConfig{
+		Webhook: &WebhookConfig{URL: srv.URL + "/default", Headers: map[string]string{"Authorization": "Bearer hook"}},
+		Teams:   map[string]TeamConfig{"web": {Webhook: srv.URL + "/web"}, "ops": {Webhook: srv.URL + "/down"}},
+	}
+	list, err := c.notifiers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := testDigest()
+	if err := list[0].notify(context.Background(), d); err != nil {
+		t.Fatal(err)
+	}
+	req := <-requests
+	if req.path != "/web" || req.auth != "Bearer hook" {
+		t.Errorf("posted to %s with %q, want /web with the configured header", req.path, req.auth)
+	}
+	if req.body["team"] != "web" || req.body["failed"] != 1.0 || !strings.Contains(req.body["text"].(string), "o/broken@dev: appID is missing") {
+		t.Errorf("body = %v", req.body)
+	}
+	d.Team = "ops"
+	if err := list[0].notify(context.Background(), d); err == nil || !strings.Contains(err.Error(), "502") {
+		t.Errorf("notify to a failing webhook = %v, want its status code", err)
+	}
+	<-requests
+}
+
+// fakeSMTP accepts one SMTP session on a local address, authenticating any
+// PLAIN credentials, and sends the message received to msgs. With silent
+// set, it never greets the client.
+func fakeSMTP(t *testing.T, silent bool, msgs chan<- string) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		if silent {
+			io.Copy(io.Discard, conn)
+			return
+		}
+		r := bufio.NewReader(conn)
+		reply := func(s string) { io.WriteString(conn, s+"\r\n") }
+		reply("220 localhost ESMTP")
+		var msg strings.Builder
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			cmd := strings.ToUpper(strings.TrimSpace(line))
+			switch {
+			case strings.HasPrefix(cmd, "EHLO"):
+				reply("250-localhost")
+				reply("250 AUTH PLAIN")
+			case strings.HasPrefix(cmd, "AUTH PLAIN"):
+				reply("235 authenticated")
+			case strings.HasPrefix(cmd, "MAIL"), strings.HasPrefix(cmd, "RCPT"):
+				msg.WriteString(strings.TrimSpace(line) + "\n")
+				reply("250 ok")
+			case cmd == "DATA":
+				reply("354 go ahead")
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if line == ".\r\n" {
+						break
+					}
+					msg.WriteString(line)
+				}
+				msgs <- msg.String()
+				reply("250 queued")
+			case cmd == "QUIT":
+				reply("221 bye")
+				return
+			default:
+				reply("502 unknown command")
+			}
+		}
+	}()
+	return l.Addr().String()
+}
+
+func TestMailNotifier(t *testing.T) {
+	msgs := make(chan string, 1)
+	addr := fakeSMTP(t, false, msgs)
+	t.Setenv("SMTP_PASSWORD", "secret")
+	m := &mailNotifier{
+		config: &SMTPConfig{Addr: addr, From: "props@example.com", Username: "props", PasswordEnv: "SMTP_PASSWORD"},
+		teams:  map[string]TeamConfig{"web": {Email: []string{"web@example.com", "lead@example.com"}}},
+	}
+	if err := m.notify(context.Background(), testDigest()); err != nil {
+		t.Fatal(err)
+	}
+	msg := <-msgs
+	for _, want := range []string{
+		"MAIL FROM:<props@example.com>",
+		"RCPT TO:<web@example.com>",
+		"RCPT TO:<lead@example.com>",
+		"Subject: props digest for web: 1 of 2 refs with problems",
+		"o/broken@dev: appID is missing",
+	} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("message lacks %q:\n%s", want, msg)
+		}
+	}
+	if err := m.notify(context.Background(), &digest{Team: "nobody"}); err != nil {
+		t.Errorf("notify to a team without address = %v", err)
+	}
+}
+
+func TestMailNotifierCancel(t *testing.T) {
+	addr := fakeSMTP(t, true, nil)
+	m := &mailNotifier{
+		config: &SMTPConfig{Addr: addr, From: "props@example.com"},
+		teams:  map[string]TeamConfig{"web": {Email: []string{"web@example.com"}}},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := m.notify(ctx, testDigest())
+	if err == nil || !strings.Contains(err.Error(), context.DeadlineExceeded.Error()) {
+		t.Errorf("notify to a silent server = %v, want %s", err, context.DeadlineExceeded)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("notify returned after %s", d)
+	}
+}
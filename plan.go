@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"iter"
+	"path/filepath"
+
+	"github.com/idletekz/go-graphql/clone"
+	"github.com/idletekz/go-graphql/discovery"
+)
+
+// printPlan writes to w what a run would do with the refs of pages: those
+// cloned into root, or skipped by q, the file fetched from every ref and
+// the commands run in its clone. Nothing is cloned, fetched or written.
+func printPlan(w io.Writer, pages iter.Seq2[[]*discovery.Repo, error], root string, q *clone.Quota, path string, cmds []Command) error {
+	var refs, skipped int
+	for page, err := range pages {
+		if err != nil {
+			return err
+		}
+		for _, r := range page {
+			refs++
+			ref := fmt.Sprintf("%s/%s@%s", r.Owner, r.Name, r.Branch)
+			if err := q.Admit(r); err != nil {
+				skipped++
+				fmt.Fprintf(w, "would skip cloning %s: %s\n", ref, err)
+			} else {
+				q.Assume(r)
+				fmt.Fprintf(w, "would clone %s (%s %s) into %s\n", ref, r.Kind, short(r.SHA), filepath.Join(root, r.CloneDir()))
+				for _, c := range cmds {
+					fmt.Fprintf(w, "  would run %s\n", c.Name)
+				}
+			}
+			fmt.Fprintf(w, "  would fetch %s at %s\n", path, r.Rev())
+		}
+	}
+	fmt.Fprintf(w, "%d active refs, %d would be cloned, %d skipped\n", refs, refs-skipped, skipped)
+	return nil
+}
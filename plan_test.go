@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"iter"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/idletekz/go-graphql/clone"
+	"github.com/idletekz/go-graphql/discovery"
+)
+
+func TestPrintPlan(t *testing.T) {
+	root := t.TempDir()
+	q, err := clone.NewQuota(&clone.Config{Dir: root, DiskBudget: 1500, MaxRepoSize: 2000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref := func(name string, size int64, kind discovery.RefKind) *discovery.Repo {
+		return &discovery.Repo{Owner: "o", Name: name, Branch: "main", SHA: "abcdef123", Kind: kind, Size: size}
+	}
+	pages := func(yield func([]*discovery.Repo, error) bool) {
+		if yield([]*discovery.Repo{ref("a", 1000, discovery.KindBranch), ref("b", 1000, discovery.KindBranch)}, nil) {
+			yield([]*discovery.Repo{ref("huge", 3000, discovery.KindBranch), ref("c", 400, discovery.KindTag)}, nil)
+		}
+	}
+	var b strings.Builder
+	if err := printPlan(&b, pages, root, q, "props.yml", []Command{{Name: "test"}}); err != nil {
+		t.Fatal(err)
+	}
+	want := `would clone o/a@main (branch abcdef1) into ` + filepath.Join(root, "o/heads/main/a") + `
+  would run test
+  would fetch props.yml at abcdef123
+would skip cloning o/b@main: o/b@main (1000B) does not fit in the disk budget: 1000B of 1.5KiB used
+  would fetch props.yml at abcdef123
+would skip cloning o/huge@main: o/huge is 2.9KiB, above the 2.0KiB limit
+  would fetch props.yml at abcdef123
+would clone o/c@main (tag abcdef1) into ` + filepath.Join(root, "o/tags/main/c") + `
+  would run test
+  would fetch props.yml at abcdef123
+4 active refs, 2 would be cloned, 2 skipped
+`
+	if b.String() != want {
+		t.Errorf("plan:\n%s\nwant:\n%s", b.String(), want)
+	}
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("plan created %s in the clone root", entries[0].Name())
+	}
+
+	var failing iter.Seq2[[]*discovery.Repo, error] = func(yield func([]*discovery.Repo, error) bool) {
+		yield(nil, errors.New("boom"))
+	}
+	if err := printPlan(&b, failing, root, q, "props.yml", nil); err == nil || err.Error() != "boom" {
+		t.Errorf("printPlan of a failed discovery = %v, want boom", err)
+	}
+}
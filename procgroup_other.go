@@ -0,0 +1,11 @@
+//go:build !unix
+
+package main
+
+import "os/exec"
+
+// killProcessGroup only bounds, without process groups, the wait for the
+// output of the processes cmd started once it was killed.
+func killProcessGroup(cmd *exec.Cmd) {
+	cmd.WaitDelay = waitDelay
+}
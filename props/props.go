@@ -0,0 +1,52 @@
+// Package props parses and validates the props file describing the
+// application a repository holds.
+package props
+
+import (
+	"gopkg.in/yaml.v2"
+)
+
+// Path is where the props file is looked up in repositories.
+const Path = "props.yml"
+
+// Props is the content of a props file.
+// Note: struct fields must be public in order for unmarshal to
+// correctly populate the data.
+type Props struct {
+	AppID   string `yaml:"appID"`
+	AppName string `yaml:"appName"`
+	Check   struct {
+		Team     string `yaml:"team"`
+		Instance string
+		Enable   bool
+	}
+}
+
+// Parse parses the props file data and returns it along with the invalid
+// values found. The error reports unparsable data.
+func Parse(data []byte) (Props, []string, error) {
+	p := Props{}
+	if err := yaml.Unmarshal(data, &p); err != nil {
+		return p, nil, err
+	}
+	return p, p.Validate(), nil
+}
+
+// Validate returns the problems found in p.
+func (p *Props) Validate() (problems []string) {
+	if p.AppID == "" {
+		problems = append(problems, "appID is missing")
+	}
+	if p.AppName == "" {
+		problems = append(problems, "appName is missing")
+	}
+	if p.Check.Enable {
+		if p.Check.Team == "" {
+			problems = append(problems, "check.team is missing while check is enabled")
+		}
+		if p.Check.Instance == "" {
+			problems = append(problems, "check.instance is missing while check is enabled")
+		}
+	}
+	return problems
+}
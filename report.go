@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/idletekz/go-graphql/discovery"
+	"github.com/idletekz/go-graphql/gql"
+	"github.com/machinebox/graphql"
+)
+
+// reportContext names the commit status and check run published for
+// props validation.
+const reportContext = "props"
+
+// reporter publishes the props validation result of a repo on the commit
+// it was evaluated on. Publishing needs write access, so reporters use the
+// primary token whatever the context.
+type reporter interface {
+	report(ctx context.Context, r *discovery.Repo, path string, problems []string) error
+}
+
+// newReporter returns the reporter for the -report flag value, or nil when
+// reporting is disabled. Check runs can only be created by a GitHub App, so
+// check needs the App auth of auth.
+func newReporter(kind string, auth *AuthConfig, client *graphql.Client) (reporter, error) {
+	switch kind {
+	case "":
+		return nil, nil
+	case "status":
+		return &statusReporter{client: &http.Client{Transport: apiTransport, Timeout: 10 * time.Second}}, nil
+	case "check":
+		if auth.App == nil {
+			return nil, fmt.Errorf("report kind check needs auth.app: check runs are created by GitHub Apps only")
+		}
+		return &checkReporter{client: client}, nil
+	}
+	return nil, fmt.Errorf("unknown report kind %q, want status or check", kind)
+}
+
+// statusReporter creates commit statuses through the REST API.
+type statusReporter struct {
+	client *http.Client
+}
+
+func (s *statusReporter) report(ctx context.Context, r *discovery.Repo, path string, problems []string) error {
+	ctx = withPrimaryToken(ctx)
+	if r.SHA == "" {
+		return fmt.Errorf("statusReporter: no commit for %s", r.Branch)
+	}
+	state := "success"
+	if len(problems) > 0 {
+		state = "failure"
+	}
+	body, err := json.Marshal(map[string]string{
+		"state":       state,
+		"description": truncate(title(path, problems), 140),
+		"context":     reportContext,
+	})
+	if err != nil {
+		return err
+	}
+	url := fmt.Sprintf("%s/repos/%s/%s/statuses/%s", restURL, r.Owner, r.Name, r.SHA)
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Add("Accept", "application/vnd.github.v3+json")
+	req.Header.Add("Content-Type", "application/json")
+	res, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("statusReporter status code: %v", res.StatusCode)
+	}
+	return nil
+}
+
+// checkReporter creates completed check runs through the GraphQL API.
+// Check runs can only be created with GitHub App credentials, see
+// AppConfig.
+type checkReporter struct {
+	client *graphql.Client
+}
+
+func (c *checkReporter) report(ctx context.Context, r *discovery.Repo, path string, problems []string) error {
+	ctx = withPrimaryToken(ctx)
+	if r.SHA == "" {
+		return fmt.Errorf("checkReporter: no commit for %s", r.Branch)
+	}
+	vars := &gql.CreateCheckRunVariables{
+		RepositoryID: r.ID,
+		HeadSHA:      r.SHA,
+		Name:         reportContext,
+		Conclusion:   gql.CheckConclusionStateSuccess,
+		CompletedAt:  time.Now(),
+		Title:        title(path, problems),
+		Summary:      summary(path, problems),
+	}
+	if len(problems) > 0 {
+		vars.Conclusion = gql.CheckConclusionStateFailure
+	}
+	req := graphql.NewRequest(gql.CreateCheckRunQuery)
+	vars.Set(req)
+	var respData gql.CreateCheckRunResponse
+	if err := c.client.Run(ctx, req, &respData); err != nil {
+		return fmt.Errorf("checkReporter: %s", err)
+	}
+	return nil
+}
+
+// title is a one line account of problems.
+func title(path string, problems []string) string {
+	switch len(problems) {
+	case 0:
+		return fmt.Sprintf("%s is valid", path)
+	case 1:
+		return problems[0]
+	}
+	return fmt.Sprintf("%s has %d problems", path, len(problems))
+}
+
+// summary is a Markdown list of problems.
+func summary(path string, problems []string) string {
+	if len(problems) == 0 {
+		return fmt.Sprintf("No problems found in `%s`.", path)
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "Problems found in `%s`:\n\n", path)
+	for _, p := range problems {
+		fmt.Fprintf(&b, "- %s\n", p)
+	}
+	return b.String()
+}
+
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n-1]) + "…"
+}
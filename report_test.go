@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/idletekz/go-graphql/discovery"
+	"github.com/machinebox/graphql"
+)
+
+func TestNewReporter(t *testing.T) {
+	app := &AuthConfig{App: &AppConfig{ID: 7}}
+	tests := []struct {
+		kind string
+		auth *AuthConfig
+		ok   bool
+	}{
+		{"", &AuthConfig{}, true},
+		{"status", &AuthConfig{}, true},
+		{"check", app, true},
+		{"check", &AuthConfig{}, false},
+		{"comment", app, false},
+	}
+	for _, tt := range tests {
+		_, err := newReporter(tt.kind, tt.auth, nil)
+		if (err == nil) != tt.ok {
+			t.Errorf("newReporter(%q) with app %v = %v", tt.kind, tt.auth.App != nil, err)
+		}
+	}
+}
+
+// testAPI points the API URLs at h, authenticated with the static tokens
+// primary and other, for the duration of the test.
+func testAPI(t *testing.T, h http.Handler) *graphql.Client {
+	srv := httptest.NewServer(h)
+	saved := []string{restURL, graphqlURL}
+	restURL, graphqlURL = srv.URL, srv.URL+"/graphql"
+	tokens = &staticTokens{names: []string{"primary", "other"}, values: []string{"primary", "other"}}
+	t.Cleanup(func() {
+		srv.Close()
+		restURL, graphqlURL = saved[0], saved[1]
+		tokens = nil
+	})
+	return graphql.NewClient(graphqlURL, graphql.WithHTTPClient(&http.Client{Transport: apiTransport}))
+}
+
+func TestReportsUsePrimaryToken(t *testing.T) {
+	var auth []string
+	client := testAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = append(auth, r.Header.Get("Authorization"))
+		if r.URL.Path == "/graphql" {
+			fmt.Fprint(w, `{"data": {"createCheckRun": {"checkRun": {"id": "c"}}}}`)
+		}
+	}))
+	for _, kind := range []string{"status", "check"} {
+		rep, err := newReporter(kind, &AuthConfig{App: &AppConfig{}}, client)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, name := range []string{"r1", "r2", "r3"} {
+			r := &discovery.Repo{Owner: "o", Name: name, Branch: "main", SHA: "abc"}
+			if err := rep.report(forRepos(context.Background(), r), r, "props.yml", nil); err != nil {
+				t.Fatalf("%s report: %s", kind, err)
+			}
+		}
+	}
+	if len(auth) != 6 {
+		t.Errorf("%d requests, want 6", len(auth))
+	}
+	for i, a := range auth {
+		if a != "Bearer primary" {
+			t.Errorf("report %d sent with %q, want the primary token", i, a)
+		}
+	}
+}
+
+func TestStatusReporter(t *testing.T) {
+	type status struct {
+		path, accept string
+		body         map[string]string
+	}
+	var got []status
+	client := testAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s := status{path: r.URL.Path, accept: r.Header.Get("Accept")}
+		if err := json.NewDecoder(r.Body).Decode(&s.body); err != nil {
+			t.Error(err)
+		}
+		got = append(got, s)
+		if strings.Contains(r.URL.Path, "/locked/") {
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	rep, err := newReporter("status", &AuthConfig{}, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &discovery.Repo{Owner: "o", Name: "r", Branch: "main", SHA: "abc123"}
+	long := strings.Repeat("é", 200)
+	tests := []struct {
+		problems    []string
+		state, desc string
+	}{
+		{nil, "success", "props.yml is valid"},
+		{[]string{"appID is missing"}, "failure", "appID is missing"},
+		{[]string{"a", "b"}, "failure", "props.yml has 2 problems"},
+		{[]string{long}, "failure", strings.Repeat("é", 139) + "…"},
+	}
+	for i, tt := range tests {
+		if err := rep.report(context.Background(), r, "props.yml", tt.problems); err != nil {
+			t.Fatal(err)
+		}
+		s := got[i]
+		if s.path != "/repos/o/r/statuses/abc123" {
+			t.Errorf("status posted to %s", s.path)
+		}
+		if s.accept != "application/vnd.github.v3+json" {
+			t.Errorf("Accept = %q", s.accept)
+		}
+		want := map[string]string{"state": tt.state, "description": tt.desc, "context": "props"}
+		for k, v := range want {
+			if s.body[k] != v {
+				t.Errorf("problems %q: %s = %q, want %q", tt.problems, k, s.body[k], v)
+			}
+		}
+	}
+	if err := rep.report(context.Background(), &discovery.Repo{Owner: "o", Name: "r", Branch: "main"}, "props.yml", nil); err == nil {
+		t.Errorf("status reported without commit")
+	}
+	locked := &discovery.Repo{Owner: "o", Name: "locked", Branch: "main", SHA: "abc123"}
+	if err := rep.report(context.Background(), locked, "props.yml", nil); err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("report on a forbidden repository = %v, want its status code", err)
+	}
+}
+
+func TestCheckReporter(t *testing.T) {
+	var vars []map[string]any
+	client := testAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Query     string
+			Variables map[string]any
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Error(err)
+		}
+		if !strings.Contains(body.Query, "mutation CreateCheckRun") {
+			t.Errorf("unexpected query %s", body.Query)
+		}
+		vars = append(vars, body.Variables)
+		fmt.Fprint(w, `{"data": {"createCheckRun": {"checkRun": {"id": "c"}}}}`)
+	}))
+	rep, err := newReporter("check", &AuthConfig{App: &AppConfig{ID: 7}}, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &discovery.Repo{ID: "R_1", Owner: "o", Name: "r", Branch: "main", SHA: "abc123"}
+	tests := []struct {
+		problems                   []string
+		conclusion, title, summary string
+	}{
+		{nil, "SUCCESS", "props.yml is valid", "No problems found in `props.yml`."},
+		{[]string{"a", "b"}, "FAILURE", "props.yml has 2 problems", "Problems found in `props.yml`:\n\n- a\n- b\n"},
+	}
+	for i, tt := range tests {
+		if err := rep.report(context.Background(), r, "props.yml", tt.problems); err != nil {
+			t.Fatal(err)
+		}
+		want := map[string]any{
+			"repositoryId": "R_1",
+			"headSha":      "abc123",
+			"name":         "props",
+			"conclusion":   tt.conclusion,
+			"title":        tt.title,
+			"summary":      tt.summary,
+		}
+		for k, v := range want {
+			if vars[i][k] != v {
+				t.Errorf("problems %q: $%s = %q, want %q", tt.problems, k, vars[i][k], v)
+			}
+		}
+		if _, ok := vars[i]["completedAt"].(string); !ok {
+			t.Errorf("$completedAt = %v", vars[i]["completedAt"])
+		}
+	}
+	if err := rep.report(context.Background(), &discovery.Repo{Owner: "o", Name: "r", Branch: "main"}, "props.yml", nil); err == nil {
+		t.Errorf("check run reported without commit")
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/idletekz/go-graphql/discovery"
+	"github.com/idletekz/go-graphql/props"
+)
+
+// defaultCommandTimeout applies to commands configured without a timeout.
+const defaultCommandTimeout = 10 * time.Minute
+
+// waitDelay bounds the wait for the output of a killed command.
+const waitDelay = 5 * time.Second
+
+// outputTail is the number of output lines shown for failed commands.
+const outputTail = 20
+
+// Command is run, in run mode, in the working tree of every clone.
+type Command struct {
+	Name    string        `yaml:"name"`
+	Command []string      `yaml:"command"`
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// runResult is the outcome of a Command on a repo.
+type runResult struct {
+	repo     *discovery.Repo
+	name     string
+	err      error
+	output   []byte // combined stdout and stderr
+	duration time.Duration
+}
+
+// runCommands runs cmds in dir, one after the other, describing r and its
+// props t through the environment, without credentialEnv. Commands are
+// killed when ctx is done.
+func runCommands(ctx context.Context, cmds []Command, r *discovery.Repo, dir string, t props.Props) []*runResult {
+	env := append(withoutEnv(os.Environ(), credentialEnv),
+		"REPO_OWNER="+r.Owner,
+		"REPO_NAME="+r.Name,
+		"REPO_URL="+r.URL,
+		"REPO_REF="+r.Branch,
+		"REPO_REF_KIND="+string(r.Kind),
+		"REPO_SHA="+r.SHA,
+		"REPO_DIR="+dir,
+		"PROPS_APP_ID="+t.AppID,
+		"PROPS_APP_NAME="+t.AppName,
+		"PROPS_CHECK_TEAM="+t.Check.Team,
+		"PROPS_CHECK_INSTANCE="+t.Check.Instance,
+		"PROPS_CHECK_ENABLE="+strconv.FormatBool(t.Check.Enable),
+	)
+	var results []*runResult
+	for _, c := range cmds {
+		results = append(results, c.run(ctx, r, dir, env))
+	}
+	return results
+}
+
+// withoutEnv returns the variables of env not named in names.
+func withoutEnv(env, names []string) []string {
+	var kept []string
+	for _, kv := range env {
+		name, _, _ := strings.Cut(kv, "=")
+		if !slices.Contains(names, name) {
+			kept = append(kept, kv)
+		}
+	}
+	return kept
+}
+
+func (c *Command) run(ctx context.Context, r *discovery.Repo, dir string, env []string) *runResult {
+	res := &runResult{repo: r, name: c.Name}
+	if len(c.Command) == 0 {
+		res.err = fmt.Errorf("command %q is empty", c.Name)
+		return res
+	}
+	timeout := c.Timeout
+	if timeout == 0 {
+		timeout = defaultCommandTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	var out bytes.Buffer
+	cmd := exec.CommandContext(ctx, c.Command[0], c.Command[1:]...)
+	killProcessGroup(cmd)
+	cmd.Dir = dir
+	cmd.Env = env
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	start := time.Now()
+	res.err = cmd.Run()
+	res.duration = time.Since(start)
+	res.output = out.Bytes()
+	switch ctx.Err() {
+	case context.DeadlineExceeded:
+		res.err = fmt.Errorf("timed out after %s", timeout)
+	case context.Canceled:
+		res.err = fmt.Errorf("interrupted")
+	}
+	return res
+}
+
+// printRunReport writes one line per result to w, followed by the output
+// tail of the failed ones, and returns the number of failures.
+func printRunReport(w io.Writer, results []*runResult) (failed int) {
+	for _, res := range results {
+		status := "PASS"
+		if res.err != nil {
+			status = "FAIL"
+			failed++
+		}
+		fmt.Fprintf(w, "%s %s/%s@%s %s (%s)\n", status, res.repo.Owner, res.repo.Name, res.repo.Branch, res.name, res.duration.Round(time.Millisecond))
+	}
+	for _, res := range results {
+		if res.err == nil {
+			continue
+		}
+		fmt.Fprintf(w, "\n--- %s/%s@%s %s: %s\n", res.repo.Owner, res.repo.Name, res.repo.Branch, res.name, res.err)
+		if len(res.output) == 0 {
+			continue
+		}
+		lines := strings.Split(strings.TrimRight(string(res.output), "\n"), "\n")
+		if len(lines) > outputTail {
+			lines = lines[len(lines)-outputTail:]
+		}
+		fmt.Fprintln(w, strings.Join(lines, "\n"))
+	}
+	fmt.Fprintf(w, "\n%d commands, %d failed\n", len(results), failed)
+	return failed
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/idletekz/go-graphql/discovery"
+	"github.com/idletekz/go-graphql/props"
+)
+
+func TestRunCommandsHidesCredentials(t *testing.T) {
+	t.Setenv("GITHUB_TOKEN", "secret")
+	t.Setenv("MY_TOKEN", "secret")
+	t.Setenv("SMTP_PASSWORD", "secret")
+	t.Setenv("KEPT", "kept")
+	credentialEnv = append((&AuthConfig{Tokens: []TokenConfig{{Env: "MY_TOKEN"}}}).envNames(),
+		(&NotifyConfig{SMTP: &SMTPConfig{PasswordEnv: "SMTP_PASSWORD"}}).envNames()...)
+	defer func() { credentialEnv = nil }()
+	r := &discovery.Repo{Owner: "o", Name: "r", Branch: "main"}
+	res := runCommands(context.Background(), []Command{{Name: "env", Command: []string{"env"}}}, r, t.TempDir(), props.Props{AppID: "app"})
+	if res[0].err != nil {
+		t.Fatal(res[0].err)
+	}
+	env := string(res[0].output)
+	for _, want := range []string{"KEPT=kept", "REPO_NAME=r", "PROPS_APP_ID=app"} {
+		if !strings.Contains(env, want+"\n") {
+			t.Errorf("environment lacks %s", want)
+		}
+	}
+	if strings.Contains(env, "secret") {
+		t.Errorf("environment holds a credential:\n%s", env)
+	}
+}
+
+func TestWithoutEnv(t *testing.T) {
+	got := withoutEnv([]string{"A=1", "AB=2", "B=3=4", "C"}, []string{"A", "B", "C"})
+	if strings.Join(got, " ") != "AB=2" {
+		t.Errorf("withoutEnv = %q, want [AB=2]", got)
+	}
+}
+
+func TestCommandTimeoutKillsChildren(t *testing.T) {
+	c := &Command{Name: "slow", Command: []string{"sh", "-c", "sleep 3; echo done"}, Timeout: 200 * time.Millisecond}
+	start := time.Now()
+	res := c.run(context.Background(), &discovery.Repo{}, t.TempDir(), nil)
+	if d := time.Since(start); d > 2*time.Second {
+		t.Errorf("command returned after %s, want about 200ms", d)
+	}
+	if res.err == nil || res.err.Error() != "timed out after 200ms" {
+		t.Errorf("err = %v, want a timeout", res.err)
+	}
+	if strings.Contains(string(res.output), "done") {
+		t.Errorf("child process ran to completion: %q", res.output)
+	}
+}
+
+func TestCommandInterrupted(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(200*time.Millisecond, cancel)
+	c := &Command{Name: "slow", Command: []string{"sh", "-c", "sleep 3 & wait"}}
+	start := time.Now()
+	res := c.run(ctx, &discovery.Repo{}, t.TempDir(), nil)
+	if d := time.Since(start); d > 2*time.Second {
+		t.Errorf("command returned after %s, want about 200ms", d)
+	}
+	if res.err == nil || res.err.Error() != "interrupted" {
+		t.Errorf("err = %v, want interrupted", res.err)
+	}
+	if res := (&Command{Name: "empty"}).run(context.Background(), &discovery.Repo{}, t.TempDir(), nil); res.err == nil {
+		t.Errorf("empty command succeeded")
+	}
+}
+
+func TestPrintRunReport(t *testing.T) {
+	r := &discovery.Repo{Owner: "o", Name: "r", Branch: "main"}
+	var output []string
+	for i := 1; i <= outputTail+5; i++ {
+		output = append(output, fmt.Sprintf("line %d", i))
+	}
+	results := []*runResult{
+		{repo: r, name: "lint", duration: 1500 * time.Millisecond, output: []byte("all good\n")},
+		{repo: r, name: "test", err: errors.New("exit status 1"), duration: 2 * time.Second, output: []byte(strings.Join(output, "\n") + "\n")},
+		{repo: r, name: "slow", err: errors.New("timed out after 1s")},
+	}
+	var b strings.Builder
+	if failed := printRunReport(&b, results); failed != 2 {
+		t.Errorf("%d failures, want 2", failed)
+	}
+	want := `PASS o/r@main lint (1.5s)
+FAIL o/r@main test (2s)
+FAIL o/r@main slow (0s)
+
+--- o/r@main test: exit status 1
+` + strings.Join(output[5:], "\n") + `
+
+--- o/r@main slow: timed out after 1s
+
+3 commands, 2 failed
+`
+	if b.String() != want {
+		t.Errorf("report:\n%s\nwant:\n%s", b.String(), want)
+	}
+}
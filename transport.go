@@ -0,0 +1,102 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/idletekz/go-graphql/clone"
+)
+
+// HTTPConfig configures the HTTP transport shared by all requests and the
+// clones. The proxy defaults to the HTTPS_PROXY, HTTP_PROXY and NO_PROXY
+// environment variables.
+type HTTPConfig struct {
+	Proxy string `yaml:"proxy"`
+	// CAFile holds PEM certificates trusted in addition to the system
+	// ones. The git binary trusts only them: the file should include the
+	// public CAs when GitHub is reached without TLS interception.
+	CAFile string `yaml:"caFile"`
+	// CertFile and KeyFile hold the PEM client certificate and key
+	// presented for mutual TLS.
+	CertFile string `yaml:"certFile"`
+	KeyFile  string `yaml:"keyFile"`
+}
+
+// baseTransport carries all HTTP traffic, below httpTransport. It is
+// configured by setupHTTP before any request is made.
+var baseTransport = http.DefaultTransport.(*http.Transport).Clone()
+
+// setupHTTP applies c to baseTransport.
+func setupHTTP(c *HTTPConfig) error {
+	if c.Proxy != "" {
+		proxy, err := url.Parse(c.Proxy)
+		if err != nil {
+			return fmt.Errorf("setupHTTP: proxy: %s", err)
+		}
+		baseTransport.Proxy = http.ProxyURL(proxy)
+	}
+	tlsConfig := &tls.Config{}
+	if c.CAFile != "" {
+		pem, err := ioutil.ReadFile(c.CAFile)
+		if err != nil {
+			return fmt.Errorf("setupHTTP: %s", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("setupHTTP: no certificate in %s", c.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if c.CertFile != "" || c.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return fmt.Errorf("setupHTTP: client certificate: %s", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	baseTransport.TLSClientConfig = tlsConfig
+	return nil
+}
+
+// restURL and graphqlURL are the GitHub APIs, set by setAPIURL.
+var (
+	restURL    = "https://api.github.com"
+	graphqlURL = "https://api.github.com/graphql"
+)
+
+// setAPIURL points restURL at the REST API u, of GitHub Enterprise Server
+// such as https://github.example.com/api/v3, and graphqlURL at the GraphQL
+// API next to it. Tarballs, App tokens and the scope of authTransport
+// follow. An empty u keeps github.com.
+func setAPIURL(u string) error {
+	if u == "" {
+		return nil
+	}
+	parsed, err := url.Parse(strings.TrimSuffix(u, "/"))
+	if err != nil {
+		return fmt.Errorf("setAPIURL: %s", err)
+	}
+	if parsed.Scheme != "https" && parsed.Scheme != "http" || parsed.Host == "" {
+		return fmt.Errorf("setAPIURL: %q is not an http(s) URL", u)
+	}
+	restURL = parsed.String()
+	if base, ok := strings.CutSuffix(restURL, "/api/v3"); ok {
+		graphqlURL = base + "/api/graphql"
+	} else {
+		graphqlURL = restURL + "/graphql"
+	}
+	return nil
+}
+
+// network returns the clone settings of c.
+func (c *HTTPConfig) network() clone.Network {
+	return clone.Network{Proxy: c.Proxy, CAFile: c.CAFile, CertFile: c.CertFile, KeyFile: c.KeyFile}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSetAPIURL(t *testing.T) {
+	saved := []string{restURL, graphqlURL}
+	defer func() { restURL, graphqlURL = saved[0], saved[1] }()
+	tests := []struct {
+		in, rest, graphql string
+	}{
+		{"", "https://api.github.com", "https://api.github.com/graphql"},
+		{"https://github.example.com/api/v3", "https://github.example.com/api/v3", "https://github.example.com/api/graphql"},
+		{"https://github.example.com/api/v3/", "https://github.example.com/api/v3", "https://github.example.com/api/graphql"},
+		{"http://localhost:8080", "http://localhost:8080", "http://localhost:8080/graphql"},
+	}
+	for _, tt := range tests {
+		restURL, graphqlURL = saved[0], saved[1]
+		if err := setAPIURL(tt.in); err != nil {
+			t.Errorf("setAPIURL(%q): %s", tt.in, err)
+			continue
+		}
+		if restURL != tt.rest || graphqlURL != tt.graphql {
+			t.Errorf("setAPIURL(%q) = %s, %s, want %s, %s", tt.in, restURL, graphqlURL, tt.rest, tt.graphql)
+		}
+	}
+	for _, bad := range []string{"github.example.com/api/v3", "ftp://github.example.com", "https://"} {
+		if err := setAPIURL(bad); err == nil {
+			t.Errorf("setAPIURL(%q) accepted", bad)
+		}
+	}
+	if err := setAPIURL("https://github.example.com/api/v3"); err != nil {
+		t.Fatal(err)
+	}
+	if !apiHost("github.example.com") || apiHost("api.github.com") {
+		t.Errorf("tokens not scoped to the configured API host")
+	}
+}
+
+// writePEM writes the PEM block of type typ holding der to a new file.
+func writePEM(t *testing.T, name, typ string, der []byte) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestSetupHTTP(t *testing.T) {
+	saved := baseTransport.Clone()
+	defer func() { baseTransport.Proxy, baseTransport.TLSClientConfig = saved.Proxy, saved.TLSClientConfig }()
+
+	// A self-signed client certificate, trusted by the server.
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "props"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientCert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCert)
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.TLS.PeerCertificates[0].Subject.CommonName)
+	}))
+	srv.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	srv.Config.ErrorLog = log.New(io.Discard, "", 0) // rejected handshakes
+	srv.StartTLS()
+	defer srv.Close()
+
+	get := func() (string, error) {
+		baseTransport.CloseIdleConnections()
+		res, err := (&http.Client{Transport: baseTransport}).Get(srv.URL)
+		if err != nil {
+			return "", err
+		}
+		defer res.Body.Close()
+		body, err := io.ReadAll(res.Body)
+		return string(body), err
+	}
+	c := &HTTPConfig{CAFile: writePEM(t, "ca.pem", "CERTIFICATE", srv.Certificate().Raw)}
+	if err := setupHTTP(c); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := get(); err == nil {
+		t.Errorf("server requiring a client certificate answered without one")
+	}
+	c.CertFile = writePEM(t, "cert.pem", "CERTIFICATE", der)
+	c.KeyFile = writePEM(t, "key.pem", "PRIVATE KEY", keyDER)
+	if err := setupHTTP(c); err != nil {
+		t.Fatal(err)
+	}
+	if cn, err := get(); err != nil || cn != "props" {
+		t.Errorf("GET with the CA and client certificate = %q, %v, want props", cn, err)
+	}
+	if err := setupHTTP(&HTTPConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := get(); err == nil {
+		t.Errorf("server certificate trusted without its CA")
+	}
+
+	for _, bad := range []*HTTPConfig{
+		{Proxy: "http://[::1"},
+		{CAFile: filepath.Join(t.TempDir(), "missing.pem")},
+		{CAFile: c.KeyFile},
+		{CertFile: c.CertFile},
+	} {
+		if err := setupHTTP(bad); err == nil {
+			t.Errorf("setupHTTP(%+v) accepted", bad)
+		}
+	}
+}